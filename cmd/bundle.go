@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/j2udev/boa"
+	"github.com/j2udev/kruise/internal/kruise"
+	"github.com/spf13/cobra"
+)
+
+func NewBundleCmd() *cobra.Command {
+	return boa.NewCmd("bundle").
+		WithValidOptions(deployOptions()...).
+		WithValidProfiles(deployProfiles()...).
+		WithOptionsTemplate().
+		WithMinValidArgs(1).
+		WithShortDescription("Bundle the charts, values and manifests of the specified options for offline deployments").
+		WithRunFunc(bundle).
+		WithBoolPFlag("dry-run", "d", false, "output the commands used to pull charts instead of writing the bundle").
+		WithStringPFlag("output", "o", "bundle.tar.gz", "the path of the bundle to write").
+		Build()
+}
+
+func bundle(cmd *cobra.Command, args []string) {
+	kruise.Bundle(cmd.Flags(), args)
+}
@@ -11,16 +11,23 @@ func NewDeleteCmd() *cobra.Command {
 		WithValidOptions(deleteOptions()...).
 		WithValidProfiles(deleteProfiles()...).
 		WithOptionsTemplate().
-		WithMinValidArgs(1).
+		WithArgs(argsOrPicker).
 		WithAliases([]string{"del"}).
 		WithShortDescription("Delete the specified options from your Kubernetes cluster").
 		WithRunFunc(delete).
 		WithBoolPFlag("dry-run", "d", false, "output the command being performed under the hood").
-		WithBoolPFlag("concurrent", "c", false, "delete the arguments concurrently (deletes in order based on the 'priority' of each deployment passed)").
+		WithBoolPFlag("concurrent", "c", false, "delete the arguments concurrently (deletes in reverse order based on the 'priority' of each deployment passed)").
+		WithIntFlag("max-parallel", 0, "the maximum number of installers to run at once with --concurrent (defaults to deploy.maxParallel, or no limit)").
+		WithBoolFlag("keep-secrets", false, "keep the secrets of the deployments passed").
+		WithBoolFlag("keep-repos", false, "keep the Helm repositories of the deployments passed").
+		WithStringSliceFlag("report", nil, "write the result of each installer to a JUnit (.xml) or JSON (.json) file, may be repeated").
 		Build()
 }
 
 func delete(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		args = kruise.PickDeployments(cmd.Flags(), "delete")
+	}
 	kruise.Delete(cmd.Flags(), args)
 }
 
@@ -11,17 +11,24 @@ func NewDeployCmd() *cobra.Command {
 		WithValidOptions(deployOptions()...).
 		WithValidProfiles(deployProfiles()...).
 		WithOptionsTemplate().
-		WithMinValidArgs(1).
+		WithArgs(argsOrPicker).
 		WithAliases([]string{"dep"}).
 		WithShortDescription("Deploy the specified options to your Kubernetes cluster").
 		WithRunFunc(deploy).
 		WithBoolPFlag("dry-run", "d", false, "output the command being performed under the hood").
 		WithBoolPFlag("concurrent", "c", false, "deploy the arguments concurrently (deploys in order based on the 'priority' of each deployment passed)").
+		WithIntFlag("max-parallel", 0, "the maximum number of installers to run at once with --concurrent (defaults to deploy.maxParallel, or no limit)").
 		WithBoolPFlag("init", "i", false, "deploy anything that should only be deployed upon initialization").
+		WithBoolFlag("force-recreate", false, "delete and recreate secrets instead of updating them in place").
+		WithStringFlag("bundle", "", "deploy from a bundle created by 'kruise bundle' instead of the config file").
+		WithStringSliceFlag("report", nil, "write the result of each installer to a JUnit (.xml) or JSON (.json) file, may be repeated").
 		Build()
 }
 
 func deploy(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		args = kruise.PickDeployments(cmd.Flags(), "deploy")
+	}
 	kruise.Deploy(cmd.Flags(), args)
 }
 
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/j2udev/boa"
+	"github.com/j2udev/kruise/internal/kruise"
+	"github.com/spf13/cobra"
+)
+
+func NewDescribeCmd() *cobra.Command {
+	return boa.NewCmd("describe").
+		WithValidOptions(deployOptions()...).
+		WithValidProfiles(deployProfiles()...).
+		WithOptionsTemplate().
+		WithMinValidArgs(1).
+		WithAliases([]string{"desc"}).
+		WithShortDescription("Describe what deploying the specified options would do, in the order it would be done").
+		WithRunFunc(describe).
+		Build()
+}
+
+func describe(cmd *cobra.Command, args []string) {
+	kruise.Describe(cmd.Flags(), args)
+}
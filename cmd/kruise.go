@@ -13,9 +13,14 @@ func NewKruiseCmd() *cobra.Command {
 		WithSubCommands(
 			NewDeployCmd(),
 			NewDeleteCmd(),
+			NewLockCmd(),
+			NewBundleCmd(),
+			NewListCmd(),
+			NewDescribeCmd(),
 		).
 		WithPersistentPreRunFunc(persistentPreRun).
 		WithStringPPersistentFlag("verbosity", "V", kruise.Logger.GetLevel().String(), "specify the log level to be used (debug, info, warn, error)").
+		WithBoolPersistentFlag("non-interactive", false, "fail instead of prompting for anything that can't be resolved from config").
 		WithVersion("0.1.0").
 		Build()
 }
@@ -43,3 +48,12 @@ func setLogLevel(cmd *cobra.Command) {
 		logger.Fatalf("Invalid verbosity level: %s", lvl)
 	}
 }
+
+// argsOrPicker requires at least one valid argument, unless there are none and
+// the deployments can be picked interactively instead
+func argsOrPicker(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && kruise.CanPick(cmd.Flags()) {
+		return nil
+	}
+	return cobra.MatchAll(cobra.MinimumNArgs(1), cobra.OnlyValidArgs)(cmd, args)
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/j2udev/boa"
+	"github.com/j2udev/kruise/internal/kruise"
+	"github.com/spf13/cobra"
+)
+
+func NewListCmd() *cobra.Command {
+	return boa.NewCmd("list [deployments|profiles]").
+		WithValidArgs([]string{"deployments", "profiles"}).
+		WithArgs(cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs)).
+		WithAliases([]string{"ls"}).
+		WithShortDescription("List the deployments and profiles of the config").
+		WithRunFunc(list).
+		WithStringPFlag("output", "o", "table", "the output format (table, wide, json or yaml)").
+		WithStringPFlag("namespace", "n", "", "only list deployments with an installer in the given namespace").
+		WithStringFlag("type", "", "only list deployments with an installer of the given type (chart, repository, manifest, kustomization, secret or exec)").
+		Build()
+}
+
+func list(cmd *cobra.Command, args []string) {
+	kruise.List(cmd.Flags(), args)
+}
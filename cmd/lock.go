@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"github.com/j2udev/boa"
+	"github.com/j2udev/kruise/internal/kruise"
+	"github.com/spf13/cobra"
+)
+
+func NewLockCmd() *cobra.Command {
+	return boa.NewCmd("lock").
+		WithValidOptions(deployOptions()...).
+		WithValidProfiles(deployProfiles()...).
+		WithOptionsTemplate().
+		WithArgs(cobra.OnlyValidArgs).
+		WithShortDescription("Pin the Helm chart versions of the specified options (or all options) in a kruise.lock file").
+		WithRunFunc(lock).
+		WithBoolPFlag("dry-run", "d", false, "output the lockfile instead of writing it").
+		WithBoolPFlag("update", "u", false, "re-resolve chart versions that are already pinned in the lockfile").
+		Build()
+}
+
+func lock(cmd *cobra.Command, args []string) {
+	kruise.Lock(cmd.Flags(), args)
+}
@@ -0,0 +1,689 @@
+package kruise
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+)
+
+type (
+	// bundler is used to vendor the charts, values files and manifests of
+	// deployments into a directory that is later archived
+	bundler struct {
+		dir    string
+		dry    bool
+		files  map[string]string
+		images map[string]bool
+	}
+)
+
+const (
+	// bundleConfigName is the name of the rewritten config inside a bundle
+	bundleConfigName = "kruise.yaml"
+	// bundleImagesName is the name of the image list inside a bundle
+	bundleImagesName = "images.txt"
+)
+
+// imagePattern matches the image references of rendered Kubernetes manifests
+var imagePattern = regexp.MustCompile(`(?m)^\s*(?:-\s*)?image:\s*["']?([^"'\s#]+)`)
+
+// Bundle vendors the charts, values files and manifests of the passed
+// deployments into a gzipped tarball that can be deployed without access to
+// any Helm repository
+//
+// The bundle contains a rewritten config that references the vendored files
+// and a list of the container images referenced by the rendered charts and
+// manifests.
+func Bundle(fs *pflag.FlagSet, args []string) {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	out, err := fs.GetString("output")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	dir, err := os.MkdirTemp("", "kruise-bundle-")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	defer atExit(func() { os.RemoveAll(dir) })()
+	defer removeDecryptedFiles()
+	deps := getPassedDeployments(args)
+	addHelmRepositories(fs, deps)
+	b := &bundler{dir: dir, dry: d, files: make(map[string]string), images: make(map[string]bool)}
+	var bundled []latest.Deployment
+	for _, dep := range deps {
+		bd, err := b.deployment(latest.Deployment(dep))
+		if err != nil {
+			Logger.Fatalf("Unable to bundle %s: %v", dep.Name, err)
+		}
+		bundled = append(bundled, bd)
+	}
+	if d {
+		return
+	}
+	cfg := latest.KruiseConfig{
+		APIVersion: Kfg.Manifest.APIVersion,
+		Kind:       Kfg.Manifest.Kind,
+		Logger:     Kfg.Manifest.Logger,
+		Deploy: latest.DeployConfig{
+			Deployments: bundled,
+			Profiles:    bundledProfiles(bundled),
+			MaxParallel: Kfg.Manifest.Deploy.MaxParallel,
+		},
+	}
+	if err := b.writeConfig(cfg); err != nil {
+		Logger.Fatal(err)
+	}
+	if err := b.writeImages(); err != nil {
+		Logger.Fatal(err)
+	}
+	if err := archiveDir(dir, out); err != nil {
+		Logger.Fatal(err)
+	}
+	Logger.Infof("Wrote bundle: %s", out)
+}
+
+// addHelmRepositories is used to add the Helm repositories of the given
+// deployments and update the ones their charts are pulled from
+func addHelmRepositories(fs *pflag.FlagSet, deps Deployments) {
+	repoMap := make(map[string]bool)
+	var charts HelmCharts
+	for _, dep := range deps {
+		helmDeployment := newHelmDeployment(dep.Helm)
+		for _, r := range helmDeployment.getHelmRepositories() {
+			if !repoMap[r.hash()] {
+				repoMap[r.hash()] = true
+				if err := r.Install(fs, nil); err != nil {
+					Logger.Error(err)
+				}
+			}
+		}
+		charts = append(charts, helmDeployment.getHelmCharts()...)
+	}
+	helmRepoUpdate(fs, chartRepositories(charts)...)
+}
+
+// bundledProfiles is used to get the profiles whose items were all bundled
+func bundledProfiles(deps []latest.Deployment) []latest.Profile {
+	var names []string
+	for _, d := range deps {
+		names = append(names, d.Name)
+	}
+	var profs []latest.Profile
+	for _, p := range Kfg.Manifest.Deploy.Profiles {
+		all := true
+		for _, item := range p.Items {
+			if dep, ok := argIsDeployment(item); !ok || !contains(names, dep.Name) {
+				all = false
+			}
+		}
+		if all {
+			profs = append(profs, p)
+		}
+	}
+	return profs
+}
+
+// deployment is used to vendor a deployment and return a copy of it that
+// references the vendored files
+//
+// Helm repositories are dropped since the charts no longer need them.
+func (b *bundler) deployment(dep latest.Deployment) (latest.Deployment, error) {
+	dep.Helm.Repositories = nil
+	var charts []latest.HelmChart
+	for _, c := range dep.Helm.Charts {
+		bc, err := b.chart(c)
+		if err != nil {
+			return dep, err
+		}
+		charts = append(charts, bc)
+	}
+	dep.Helm.Charts = charts
+	var manifests []latest.KubectlManifest
+	for _, m := range dep.Kubectl.Manifests {
+		bm, err := b.manifest(m)
+		if err != nil {
+			return dep, err
+		}
+		manifests = append(manifests, bm)
+	}
+	// kustomizations are rendered so that any remote bases are vendored too
+	for _, k := range dep.Kubectl.Kustomizations {
+		bm, err := b.kustomization(k)
+		if err != nil {
+			return dep, err
+		}
+		manifests = append(manifests, bm)
+	}
+	dep.Kubectl.Manifests = manifests
+	dep.Kubectl.Kustomizations = nil
+	secrets, err := b.secrets(dep.Kubectl.Secrets)
+	if err != nil {
+		return dep, err
+	}
+	dep.Kubectl.Secrets = secrets
+	var execs []latest.Exec
+	for _, e := range dep.Exec {
+		if e.Dir != "" {
+			bd, err := b.file(e.Dir)
+			if err != nil {
+				return dep, err
+			}
+			e.Dir = bd
+		}
+		execs = append(execs, e)
+	}
+	dep.Exec = execs
+	for _, hooks := range []*[]latest.Hook{&dep.Hooks.PreDeploy, &dep.Hooks.PostDeploy, &dep.Hooks.PreDelete, &dep.Hooks.PostDelete} {
+		bh, err := b.hooks(*hooks)
+		if err != nil {
+			return dep, err
+		}
+		*hooks = bh
+	}
+	return dep, nil
+}
+
+// secrets is used to vendor the files that generic and TLS secrets are read
+// from
+func (b *bundler) secrets(s latest.KubectlSecrets) (latest.KubectlSecrets, error) {
+	var generic []latest.KubectlGenericSecret
+	for _, g := range s.Generic {
+		var fromFile []latest.KeyFile
+		for _, f := range g.FromFile {
+			bf, err := b.file(f.Path)
+			if err != nil {
+				return s, err
+			}
+			f.Path = bf
+			fromFile = append(fromFile, f)
+		}
+		g.FromFile = fromFile
+		var fromEnvFile []string
+		for _, f := range g.FromEnvFile {
+			bf, err := b.file(f)
+			if err != nil {
+				return s, err
+			}
+			fromEnvFile = append(fromEnvFile, bf)
+		}
+		g.FromEnvFile = fromEnvFile
+		generic = append(generic, g)
+	}
+	s.Generic = generic
+	var tls []latest.KubectlTLSSecret
+	for _, t := range s.TLS {
+		for _, f := range []*string{&t.Cert, &t.Key} {
+			if *f == "" {
+				continue
+			}
+			bf, err := b.file(*f)
+			if err != nil {
+				return s, err
+			}
+			*f = bf
+		}
+		tls = append(tls, t)
+	}
+	s.TLS = tls
+	return s, nil
+}
+
+// hooks is used to vendor the manifests of the given hooks
+func (b *bundler) hooks(hooks []latest.Hook) ([]latest.Hook, error) {
+	var bundled []latest.Hook
+	for _, h := range hooks {
+		bm, err := b.manifest(h.Manifest)
+		if err != nil {
+			return nil, err
+		}
+		h.Manifest = bm
+		bundled = append(bundled, h)
+	}
+	return bundled, nil
+}
+
+// chart is used to pull a chart at its pinned version, vendor its values files
+// and record the images it references
+func (b *bundler) chart(c latest.HelmChart) (latest.HelmChart, error) {
+	var values []string
+	for _, v := range c.Values {
+		bv, err := b.file(v)
+		if err != nil {
+			return c, err
+		}
+		values = append(values, bv)
+	}
+	c.Values = values
+	if c.ChartPath != "" {
+		p, err := b.file(c.ChartPath)
+		if err != nil {
+			return c, err
+		}
+		c.ChartPath = p
+	} else {
+		hc := HelmChart(c)
+		hc.Version = hc.version()
+		if l, err := hc.resolve(); err == nil {
+			hc.Version = l.Version
+		} else if hc.Version == "" {
+			return c, err
+		}
+		err := helmExecute(nil, b.dry, []string{
+			"pull",
+			hc.chart(),
+			"--version",
+			hc.Version,
+			"--destination",
+			filepath.Join(b.dir, "charts"),
+		})
+		if err != nil {
+			return c, err
+		}
+		c.Version = hc.Version
+		c.ChartPath = path.Join("charts", fmt.Sprintf("%s-%s.tgz", c.ChartName, c.Version))
+	}
+	if b.dry {
+		return c, nil
+	}
+	rendered, err := NewCmd("helm").
+		WithArgs(HelmChart(c).templateArgs(b.dir)).
+		Build().
+		Output()
+	if err != nil {
+		return c, err
+	}
+	b.addImages(rendered)
+	return c, nil
+}
+
+// manifest is used to vendor the paths of a manifest and record the images it
+// references
+func (b *bundler) manifest(m latest.KubectlManifest) (latest.KubectlManifest, error) {
+	var paths []string
+	for _, p := range m.Paths {
+		bp, err := b.file(p)
+		if err != nil {
+			return m, err
+		}
+		paths = append(paths, bp)
+		if b.dry {
+			continue
+		}
+		err = filepath.WalkDir(filepath.Join(b.dir, bp), func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			content, err := os.ReadFile(p)
+			b.addImages(content)
+			return err
+		})
+		if err != nil {
+			return m, err
+		}
+	}
+	m.Paths = paths
+	return m, nil
+}
+
+// kustomization is used to render a kustomization into a vendored manifest and
+// record the images it references
+func (b *bundler) kustomization(k latest.KubectlKustomization) (latest.KubectlManifest, error) {
+	key := "kustomization:" + k.Path
+	bp, ok := b.files[key]
+	if !ok {
+		bp = path.Join("kustomizations", fmt.Sprintf("%d.yaml", len(b.files)))
+		b.files[key] = bp
+	}
+	m := latest.KubectlManifest{
+		Namespace: k.Namespace,
+		Priority:  k.Priority,
+		Paths:     []string{bp},
+		WaitFor:   k.WaitFor,
+		Init:      k.Init,
+	}
+	if ok {
+		return m, nil
+	}
+	rendered, err := NewCmd("kubectl").
+		WithArgs([]string{"kustomize", k.Path}).
+		WithDryRun(b.dry).
+		Build().
+		Output()
+	if err != nil || b.dry {
+		return m, err
+	}
+	b.addImages(rendered)
+	return m, writeFile(filepath.Join(b.dir, filepath.FromSlash(bp)), rendered, 0644)
+}
+
+// file is used to copy a local file or directory (or download a remote file)
+// into the bundle and return its path relative to the root of the bundle
+//
+// Relative paths keep their location, anything else is stored under files/.
+// Remote files are verified against their sha256 pin if they have one.
+func (b *bundler) file(p string) (string, error) {
+	if bp, ok := b.files[p]; ok {
+		return bp, nil
+	}
+	var bp string
+	switch {
+	case isURL(p):
+		// remote files with the same name are told apart by their URL
+		u, _, _ := strings.Cut(p, sha256Pin)
+		base := path.Base(u)
+		if parsed, err := url.Parse(u); err == nil {
+			base = path.Base(parsed.Path)
+		}
+		bp = path.Join("files", "remote", sha256Hex([]byte(u))[:16]+"-"+base)
+	case filepath.IsAbs(p) || !filepath.IsLocal(p):
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return "", err
+		}
+		bp = path.Join("files", strings.TrimPrefix(filepath.ToSlash(abs), "/"))
+	default:
+		bp = filepath.ToSlash(filepath.Clean(p))
+	}
+	b.files[p] = bp
+	if b.dry {
+		return bp, nil
+	}
+	dst := filepath.Join(b.dir, filepath.FromSlash(bp))
+	if isURL(p) {
+		cached, err := fetchRemoteFile(p)
+		if err != nil {
+			return "", err
+		}
+		return bp, copyPath(cached, dst)
+	}
+	return bp, copyPath(p, dst)
+}
+
+// addImages is used to record the image references in the given manifests
+func (b *bundler) addImages(manifests []byte) {
+	for _, m := range imagePattern.FindAllSubmatch(manifests, -1) {
+		b.images[string(m[1])] = true
+	}
+}
+
+// writeConfig is used to write the rewritten config to the bundle
+func (b *bundler) writeConfig(cfg latest.KruiseConfig) error {
+	content, err := marshalYAML(cfg)
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(b.dir, bundleConfigName), content, 0644)
+}
+
+// writeImages is used to write the sorted list of recorded images to the
+// bundle
+func (b *bundler) writeImages() error {
+	var images []string
+	for i := range b.images {
+		images = append(images, i)
+	}
+	sort.Strings(images)
+	content := strings.Join(images, "\n")
+	if content != "" {
+		content += "\n"
+	}
+	return writeFile(filepath.Join(b.dir, bundleImagesName), []byte(content), 0644)
+}
+
+// templateArgs is used to build Helm template CLI args for a bundled chart
+// whose paths are relative to the given directory
+func (c HelmChart) templateArgs(dir string) []string {
+	args := []string{
+		"template",
+		c.ReleaseName,
+		filepath.Join(dir, c.ChartPath),
+		"--namespace",
+		c.Namespace,
+	}
+	for _, val := range c.Values {
+		args = append(args, "-f", decryptedValuesFile(filepath.Join(dir, val)))
+	}
+	for _, val := range c.SetValues {
+		args = append(args, "--set", val)
+	}
+	return args
+}
+
+// openBundle is used to extract a bundle created by Bundle and return the
+// directory it was extracted to
+//
+// The directory is removed when Kruise exits.
+func openBundle(bundle string) string {
+	dir, err := os.MkdirTemp("", "kruise-bundle-")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	atExit(func() {
+		if err := os.RemoveAll(dir); err != nil {
+			Logger.Debug(err)
+		}
+	})
+	if err := extractArchive(bundle, dir); err != nil {
+		Logger.Fatalf("Unable to extract bundle %s: %v", bundle, err)
+	}
+	Logger.Debugf("Extracted bundle %s to %s", bundle, dir)
+	return dir
+}
+
+// resolveBundlePaths is used to resolve the relative paths of a bundled config
+// against the directory the bundle was extracted to, rather than the working
+// directory
+func (k *Konfig) resolveBundlePaths() {
+	if k.BundleDir == "" {
+		return
+	}
+	resolve := func(p string) string {
+		if p == "" || isURL(p) || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(k.BundleDir, filepath.FromSlash(p))
+	}
+	manifest := func(m *latest.KubectlManifest) {
+		for n := range m.Paths {
+			m.Paths[n] = resolve(m.Paths[n])
+		}
+	}
+	for n := range k.Manifest.Deploy.Deployments {
+		dep := &k.Manifest.Deploy.Deployments[n]
+		for c := range dep.Helm.Charts {
+			chart := &dep.Helm.Charts[c]
+			chart.ChartPath = resolve(chart.ChartPath)
+			for v := range chart.Values {
+				chart.Values[v] = resolve(chart.Values[v])
+			}
+		}
+		for m := range dep.Kubectl.Manifests {
+			manifest(&dep.Kubectl.Manifests[m])
+		}
+		for e := range dep.Exec {
+			dep.Exec[e].Dir = resolve(dep.Exec[e].Dir)
+		}
+		for _, g := range dep.Kubectl.Secrets.Generic {
+			for f := range g.FromFile {
+				g.FromFile[f].Path = resolve(g.FromFile[f].Path)
+			}
+			for f := range g.FromEnvFile {
+				g.FromEnvFile[f] = resolve(g.FromEnvFile[f])
+			}
+		}
+		for t := range dep.Kubectl.Secrets.TLS {
+			tls := &dep.Kubectl.Secrets.TLS[t]
+			tls.Cert = resolve(tls.Cert)
+			tls.Key = resolve(tls.Key)
+		}
+		for _, hooks := range [][]latest.Hook{dep.Hooks.PreDeploy, dep.Hooks.PostDeploy, dep.Hooks.PreDelete, dep.Hooks.PostDelete} {
+			for h := range hooks {
+				manifest(&hooks[h].Manifest)
+			}
+		}
+	}
+}
+
+// bundleFromArgs is used to find the value of the --bundle flag in the raw
+// command line arguments
+//
+// A bundle carries its own config, which has to be read before the CLI (whose
+// options are driven by config) is built, so the flag can't wait for cobra to
+// parse it.
+func bundleFromArgs(args []string) string {
+	for i, a := range args {
+		if a == "--" {
+			break
+		}
+		if v, ok := strings.CutPrefix(a, "--bundle="); ok {
+			return v
+		}
+		if a == "--bundle" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// archiveDir is used to write the contents of a directory to a gzipped tarball
+func archiveDir(dir string, out string) error {
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		src, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// extractArchive is used to extract a gzipped tarball into a directory
+//
+// Only regular files and directories are extracted and entries may not escape
+// the directory.
+func extractArchive(archive string, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(hdr.Name) {
+			return fmt.Errorf("invalid path in archive: %s", hdr.Name)
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(hdr.Name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dst, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fs.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			out.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// copyPath is used to copy a file or directory to the given destination
+func copyPath(src string, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return writeFile(target, content, 0644)
+	})
+}
+
+// writeFile is used to write a file, creating any missing parent directories
+func writeFile(name string, content []byte, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, content, perm)
+}
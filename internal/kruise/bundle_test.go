@@ -0,0 +1,88 @@
+package kruise
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundleFromArgs(t *testing.T) {
+	assert.Equal(t, "b.tar.gz", bundleFromArgs([]string{"deploy", "--bundle", "b.tar.gz", "istio"}))
+	assert.Equal(t, "b.tar.gz", bundleFromArgs([]string{"deploy", "istio", "--bundle=b.tar.gz"}))
+	assert.Equal(t, "", bundleFromArgs([]string{"deploy", "istio", "--", "--bundle", "b.tar.gz"}))
+	assert.Equal(t, "", bundleFromArgs([]string{"deploy", "--bundle"}))
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	assert.NoError(t, writeFile(filepath.Join(src, "values", "a.yaml"), []byte("a: 1\n"), 0644))
+	assert.NoError(t, writeFile(filepath.Join(src, bundleConfigName), []byte("kind: Config\n"), 0644))
+	archive := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	assert.NoError(t, archiveDir(src, archive))
+	dst := t.TempDir()
+	assert.NoError(t, extractArchive(archive, dst))
+	content, err := os.ReadFile(filepath.Join(dst, "values", "a.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a: 1\n", string(content))
+}
+
+func TestImagePattern(t *testing.T) {
+	b := &bundler{images: make(map[string]bool)}
+	b.addImages([]byte(`
+containers:
+- name: a
+  image: "docker.io/istio/proxyv2:1.14.1"
+- image: busybox # sidecar
+  name: b
+`))
+	assert.Equal(t, map[string]bool{"docker.io/istio/proxyv2:1.14.1": true, "busybox": true}, b.images)
+}
+
+func TestResolveBundlePaths(t *testing.T) {
+	k := &Konfig{BundleDir: "/tmp/bundle"}
+	k.Manifest.Deploy.Deployments = []latest.Deployment{{
+		Name: "istio",
+		Helm: latest.HelmDeployment{Charts: []latest.HelmChart{{ChartPath: "charts/base-1.14.1.tgz", Values: []string{"values/base.yaml", "/abs/values.yaml"}}}},
+	}}
+	k.resolveBundlePaths()
+	c := k.Manifest.Deploy.Deployments[0].Helm.Charts[0]
+	assert.Equal(t, filepath.Join("/tmp/bundle", "charts", "base-1.14.1.tgz"), c.ChartPath)
+	assert.Equal(t, []string{filepath.Join("/tmp/bundle", "values", "base.yaml"), "/abs/values.yaml"}, c.Values)
+}
+
+func TestBundlerSecrets(t *testing.T) {
+	b := &bundler{dry: true, files: make(map[string]string)}
+	s := latest.KubectlSecrets{
+		Generic: []latest.KubectlGenericSecret{{Name: "app", FromFile: []latest.KeyFile{{Key: "config", Path: "secrets/config.json"}}, FromEnvFile: []string{"/abs/app.env"}}},
+		TLS:     []latest.KubectlTLSSecret{{Name: "tls", Cert: "certs/tls.crt", Key: "certs/tls.key"}, {Name: "dev", SelfSigned: latest.SelfSignedCert{Hosts: []string{"localhost"}}}},
+	}
+	bs, err := b.secrets(s)
+	assert.NoError(t, err)
+	assert.Equal(t, "secrets/config.json", bs.Generic[0].FromFile[0].Path)
+	assert.Equal(t, []string{"files/abs/app.env"}, bs.Generic[0].FromEnvFile)
+	assert.Equal(t, "/abs/app.env", s.Generic[0].FromEnvFile[0], "the config being bundled isn't modified")
+	assert.Equal(t, "certs/tls.crt", bs.TLS[0].Cert)
+	assert.Equal(t, "certs/tls.key", bs.TLS[0].Key)
+	assert.Empty(t, bs.TLS[1].Cert)
+	k := &Konfig{BundleDir: "/tmp/bundle"}
+	k.Manifest.Deploy.Deployments = []latest.Deployment{{Name: "app", Kubectl: latest.KubectlDeployment{Secrets: bs}}}
+	k.resolveBundlePaths()
+	resolved := k.Manifest.Deploy.Deployments[0].Kubectl.Secrets
+	assert.Equal(t, filepath.Join("/tmp/bundle", "files", "abs", "app.env"), resolved.Generic[0].FromEnvFile[0])
+	assert.Equal(t, filepath.Join("/tmp/bundle", "certs", "tls.key"), resolved.TLS[0].Key)
+	assert.Empty(t, resolved.TLS[1].Key)
+}
+
+func TestBundlerRemoteFileNames(t *testing.T) {
+	b := &bundler{dry: true, files: make(map[string]string)}
+	a, err := b.file("https://example.com/a/crds.yaml")
+	assert.NoError(t, err)
+	c, err := b.file("https://example.com/b/crds.yaml")
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, c)
+	assert.Equal(t, "crds.yaml", path.Base(a)[17:])
+}
@@ -1,10 +1,13 @@
 package kruise
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"strings"
 )
 
 type (
@@ -14,8 +17,12 @@ type (
 	Command struct {
 		Name   string
 		Args   []string
+		Stdin  []byte
+		Env    []string
+		Dir    string
 		DryRun bool
 		StdOut bool
+		Out    io.Writer
 	}
 
 	// CommandBuilder is used to build a Kruise Command
@@ -26,17 +33,51 @@ type (
 	// ICommand defines the functions for a Kruise Command
 	ICommand interface {
 		Execute() error
+		Output() ([]byte, error)
+		Stream() error
+	}
+
+	// commandError represents a Kruise Command that exited unsuccessfully or
+	// wrote to stderr, along with its exit code
+	commandError struct {
+		exitCode int
+		stderr   string
+		err      error
+	}
+
+	// lineWriter is an io.Writer that only passes whole lines on to the
+	// underlying io.Writer, so that a sensitive value is never split across
+	// two writes where it can't be masked
+	lineWriter struct {
+		w   io.Writer
+		buf []byte
 	}
 
 	// ICommandBuilder defines the builder functions for the Kruise CommandBuilder
 	ICommandBuilder interface {
 		WithArgs(a []string) ICommandBuilder
+		WithStdin(in []byte) ICommandBuilder
+		WithEnv(env []string) ICommandBuilder
+		WithDir(dir string) ICommandBuilder
 		WithDryRun(dr bool) ICommandBuilder
 		WithNoStdOut() ICommandBuilder
+		WithOutput(w io.Writer) ICommandBuilder
 		Build() ICommand
 	}
 )
 
+// output is where the output of commands is written instead of stdout, if set
+var output io.Writer
+
+// stdoutWriter is used to get where the output of commands, and anything else
+// Kruise prints while installing, is written
+func stdoutWriter() io.Writer {
+	if output != nil {
+		return output
+	}
+	return os.Stdout
+}
+
 // NewCmd returns a new Kruise ICommmandBuilder
 //
 // Not to be confused with the Kruise Kommand which is a wrapper for the cobra
@@ -52,6 +93,28 @@ func (c CommandBuilder) WithArgs(args []string) ICommandBuilder {
 	return c
 }
 
+// WithStdin defines the input passed to a command on stdin
+//
+// Sensitive data should be passed on stdin rather than as arguments, where it
+// would be visible to other users in the process list.
+func (c CommandBuilder) WithStdin(in []byte) ICommandBuilder {
+	c.Stdin = in
+	return c
+}
+
+// WithEnv defines KEY=value environment variables that are added to the
+// environment of the current process for a command
+func (c CommandBuilder) WithEnv(env []string) ICommandBuilder {
+	c.Env = env
+	return c
+}
+
+// WithDir defines the working directory of a command
+func (c CommandBuilder) WithDir(dir string) ICommandBuilder {
+	c.Dir = dir
+	return c
+}
+
 // WithDryRun determines whether the command should be printed or executed
 func (c CommandBuilder) WithDryRun(dr bool) ICommandBuilder {
 	c.DryRun = dr
@@ -65,43 +128,190 @@ func (c CommandBuilder) WithNoStdOut() ICommandBuilder {
 	return c
 }
 
+// WithOutput defines where the output of a command, or the command itself
+// during a dry run, is written instead of stdout
+func (c CommandBuilder) WithOutput(w io.Writer) ICommandBuilder {
+	c.Out = w
+	return c
+}
+
 // Build returns an ICommand from a CommandBuilder
 func (c CommandBuilder) Build() ICommand {
 	return Command{
 		Name:   c.Name,
 		Args:   c.Args,
+		Stdin:  c.Stdin,
+		Env:    c.Env,
+		Dir:    c.Dir,
 		DryRun: c.DryRun,
 		StdOut: c.StdOut,
+		Out:    c.Out,
 	}
 }
 
 // Execute is used to execute the Kruise Command
+//
+// A commandError is returned if the command exits unsuccessfully or writes
+// anything to stderr, in which case its stdout isn't printed.
 func (c Command) Execute() error {
-	cmd := exec.Command(c.Name, c.Args...)
+	cmd := c.cmd()
 	if c.DryRun {
-		fmt.Printf("%s\n", cmd)
-	} else {
-		stderr, _ := cmd.StderrPipe()
-		stdout, _ := cmd.StdoutPipe()
-		if err := cmd.Start(); err != nil {
-			err = cmd.Wait()
-			if err != nil {
-				Logger.Fatal(err)
-			}
-			return err
-		}
-		cmdErr, _ := io.ReadAll(stderr)
-		cmdOut, _ := io.ReadAll(stdout)
-		if len(cmdErr) > 0 {
-			return errors.New(string(cmdErr))
-		}
-		if c.StdOut {
-			fmt.Printf("%s", cmdOut)
-		}
-		err := cmd.Wait()
-		if err != nil {
-			Logger.Fatal(err)
-		}
+		c.print(cmd)
+		return nil
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+	if err != nil || stderr.Len() > 0 {
+		return newCommandError(err, stderr.String())
+	}
+	if c.StdOut {
+		fmt.Fprintf(c.stdout(), "%s", redact(stdout.String()))
 	}
 	return nil
 }
+
+// Output is used to execute the Kruise Command and return its stdout rather
+// than printing it
+//
+// If DryRun is set the command is printed and no output is returned.
+func (c Command) Output() ([]byte, error) {
+	cmd := c.cmd()
+	if c.DryRun {
+		c.print(cmd)
+		return nil, nil
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return out, newCommandError(err, stderr.String())
+	}
+	return out, err
+}
+
+// Stream is used to execute the Kruise Command, writing its stdout and stderr
+// line by line as they are produced, with sensitive values masked
+//
+// An error is returned if the command can't be started, or a commandError if
+// it doesn't exit successfully. If DryRun is set the command is printed
+// instead.
+func (c Command) Stream() error {
+	cmd := c.cmd()
+	if c.DryRun {
+		c.print(cmd)
+		return nil
+	}
+	w := &lineWriter{w: redactWriter{c.stdout()}}
+	// using the same io.Writer for both keeps their lines in order
+	cmd.Stdout = w
+	cmd.Stderr = w
+	err := cmd.Run()
+	if ferr := w.flush(); err == nil {
+		err = ferr
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		// stderr was already streamed along with stdout
+		return newCommandError(err, "")
+	}
+	return err
+}
+
+// newCommandError is used to build the commandError of a Kruise Command from
+// the error it exited with, if any, and what it wrote to stderr
+func newCommandError(err error, stderr string) *commandError {
+	e := &commandError{stderr: redact(strings.TrimSpace(stderr)), err: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.exitCode = exitErr.ExitCode()
+	}
+	return e
+}
+
+// Error is used to get what the command wrote to stderr, or how it exited if
+// it didn't write anything
+func (e *commandError) Error() string {
+	if e.stderr != "" {
+		return e.stderr
+	}
+	return e.err.Error()
+}
+
+// ExitCode is used to get the exit code of the command, which is 0 if it
+// exited successfully but wrote to stderr
+func (e *commandError) ExitCode() int {
+	return e.exitCode
+}
+
+// Unwrap is used to get the error the command exited with, if any
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// Write is used to write every complete line of p to the underlying
+// io.Writer, holding on to the rest until it is complete
+func (l *lineWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	n := bytes.LastIndexByte(l.buf, '\n')
+	if n < 0 {
+		return len(p), nil
+	}
+	if _, err := l.w.Write(l.buf[:n+1]); err != nil {
+		return 0, err
+	}
+	l.buf = append(l.buf[:0], l.buf[n+1:]...)
+	return len(p), nil
+}
+
+// flush is used to write anything left over that isn't a complete line
+func (l *lineWriter) flush() error {
+	if len(l.buf) == 0 {
+		return nil
+	}
+	_, err := l.w.Write(l.buf)
+	l.buf = l.buf[:0]
+	return err
+}
+
+// cmd is used to build the exec.Cmd for the Kruise Command
+func (c Command) cmd() *exec.Cmd {
+	cmd := exec.Command(c.Name, c.Args...)
+	if c.Stdin != nil {
+		cmd.Stdin = bytes.NewReader(c.Stdin)
+	}
+	if len(c.Env) > 0 {
+		cmd.Env = append(os.Environ(), c.Env...)
+	}
+	cmd.Dir = c.Dir
+	return cmd
+}
+
+// print is used to print the Kruise Command, and any input passed on stdin as
+// a heredoc, with sensitive values masked
+func (c Command) print(cmd *exec.Cmd) {
+	s := strings.Join(append(append([]string{}, c.Env...), cmd.String()), " ")
+	if c.Dir != "" {
+		s = fmt.Sprintf("cd %s && %s", c.Dir, s)
+	}
+	if c.Stdin == nil {
+		fmt.Fprintf(c.stdout(), "%s\n", redact(s))
+		return
+	}
+	in := strings.TrimSuffix(string(c.Stdin), "\n")
+	fmt.Fprintf(c.stdout(), "%s <<EOF\n%s\nEOF\n", redact(s), redact(in))
+}
+
+// stdout is used to get where the output of the Kruise Command is written
+func (c Command) stdout() io.Writer {
+	if c.Out != nil {
+		return c.Out
+	}
+	return stdoutWriter()
+}
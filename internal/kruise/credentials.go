@@ -0,0 +1,244 @@
+package kruise
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/adrg/xdg"
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+)
+
+// answers keeps track of the credentials entered or resolved during a run
+var answers = struct {
+	mu          sync.Mutex
+	credentials map[string][2]string
+}{credentials: make(map[string][2]string)}
+
+type (
+	// dockerConfig represents the parts of a docker config.json (or Helm
+	// registry config, which shares its format) used to look up credentials
+	dockerConfig struct {
+		Auths       map[string]dockerAuth `json:"auths"`
+		CredsStore  string                `json:"credsStore,omitempty"`
+		CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+	}
+	// dockerAuth represents the credentials of a single registry in a docker
+	// config.json
+	dockerAuth struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	// dockerCredentialHelperOutput represents the output of a docker
+	// credential helper's get command
+	dockerCredentialHelperOutput struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}
+)
+
+// promptCredentials is used to get a username and password for the given
+// server from the given credential sources, prompting for anything that
+// doesn't resolve
+//
+// Credentials are kept for the rest of the run and shared by everything that
+// uses the same sources for the same host, so the user is only asked once.
+func promptCredentials(fs *pflag.FlagSet, creds latest.Credentials, server string, desc string) (string, string) {
+	key := credentialsKey(creds, server, desc)
+	answers.mu.Lock()
+	defer answers.mu.Unlock()
+	if c, ok := answers.credentials[key]; ok {
+		return c[0], c[1]
+	}
+	u, p, err := resolveCredentials(creds, server)
+	if err != nil {
+		Logger.Fatalf("Unable to resolve the credentials for %s: %v", desc, err)
+	}
+	if u == "" {
+		u = normalInputPrompt(fs, fmt.Sprintf("Please enter your username for %s", desc))
+	}
+	if p == "" {
+		p = sensitiveInputPrompt(fs, fmt.Sprintf("Please enter your password for %s", desc))
+	}
+	answers.credentials[key] = [2]string{u, p}
+	return u, p
+}
+
+// credentialsKey is used to identify the credentials of a server, or of the
+// given description for credentials that aren't tied to a server
+func credentialsKey(creds latest.Credentials, server string, desc string) string {
+	key := desc
+	if server != "" {
+		key = registryHost(server)
+	}
+	h := sha1.New()
+	hashSecretSource(h, creds.Username)
+	hashSecretSource(h, creds.Password)
+	h.Write([]byte(creds.DockerConfig))
+	h.Write([]byte(creds.HelmRegistryConfig))
+	return key + "/" + base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// resolveCredentials is used to resolve a username and password for the given
+// server from the given credential sources
+//
+// Empty values are returned for anything that doesn't resolve.
+func resolveCredentials(creds latest.Credentials, server string) (string, string, error) {
+	u, err := resolveSecretSource(creds.Username)
+	if err != nil {
+		return "", "", err
+	}
+	p, err := resolveSecretSource(creds.Password)
+	if err != nil {
+		return "", "", err
+	}
+	for _, cfg := range []string{creds.DockerConfig, creds.HelmRegistryConfig} {
+		if cfg == "" || (u != "" && p != "") {
+			continue
+		}
+		cu, cp, err := dockerConfigCredentials(expandHome(cfg), server)
+		if err != nil {
+			return "", "", err
+		}
+		if u == "" {
+			u = cu
+		}
+		if p == "" {
+			p = cp
+		}
+	}
+	return u, p, nil
+}
+
+// resolveSecretSource is used to read the value of a SecretSource
+//
+// An unset environment variable is not an error so that a prompt can be used
+// as a fallback; a missing file or failing command is.
+func resolveSecretSource(src latest.SecretSource) (string, error) {
+	switch {
+	case src.Value != "":
+		return decryptValue(src.Value)
+	case src.Env != "":
+		return os.Getenv(src.Env), nil
+	case src.File != "":
+		b, err := os.ReadFile(expandHome(src.File))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	case src.Ref != "":
+		return resolveSecretRef(src.Ref)
+	case src.Command != "":
+		out, err := NewCmd("sh").
+			WithArgs([]string{"-c", src.Command}).
+			Build().
+			Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", src.Command, err)
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	return "", nil
+}
+
+// dockerConfigCredentials is used to look up the username and password of the
+// given server in a docker config.json, including any configured credential
+// helpers
+func dockerConfigCredentials(path string, server string) (string, string, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		Logger.Debugf("Docker config %s does not exist", path)
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	var cfg dockerConfig
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return "", "", fmt.Errorf("invalid docker config %s: %w", path, err)
+	}
+	host := registryHost(server)
+	for k, a := range cfg.Auths {
+		if registryHost(k) != host {
+			continue
+		}
+		if a.Username != "" || a.Password != "" {
+			return a.Username, a.Password, nil
+		}
+		if a.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return "", "", fmt.Errorf("invalid auth for %s in %s: %w", k, path, err)
+			}
+			u, p, _ := strings.Cut(string(decoded), ":")
+			return u, p, nil
+		}
+	}
+	helper := cfg.CredsStore
+	for k, h := range cfg.CredHelpers {
+		if registryHost(k) == host {
+			helper = h
+		}
+	}
+	if helper == "" {
+		return "", "", nil
+	}
+	return dockerCredentialHelper(helper, host)
+}
+
+// dockerCredentialHelper is used to get the username and password of the given
+// server from a docker credential helper
+func dockerCredentialHelper(helper string, server string) (string, string, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(server)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// credential helpers report unknown servers on stdout
+		Logger.Debugf("docker-credential-%s: %s%s", helper, out, stderr.String())
+		return "", "", nil
+	}
+	var creds dockerCredentialHelperOutput
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", err
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+// registryHost is used to normalize a registry server or repository URL to its
+// host so that entries like https://index.docker.io/v1/ and index.docker.io
+// match
+func registryHost(server string) string {
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
+	}
+	u, err := url.Parse(server)
+	if err != nil {
+		return server
+	}
+	return u.Host
+}
+
+// expandHome is used to expand a leading ~ in a path to the user's home
+// directory
+func expandHome(path string) string {
+	if path == "~" {
+		return xdg.Home
+	}
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(xdg.Home, path[2:])
+	}
+	return path
+}
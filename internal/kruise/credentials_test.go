@@ -0,0 +1,85 @@
+package kruise
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveSecretSource(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "password")
+	assert.NoError(t, os.WriteFile(file, []byte("from-file\n"), 0600))
+	t.Setenv("KRUISE_TEST_PASSWORD", "from-env")
+	tests := []struct {
+		src      latest.SecretSource
+		expected string
+	}{
+		{latest.SecretSource{Value: "from-value"}, "from-value"},
+		{latest.SecretSource{Env: "KRUISE_TEST_PASSWORD"}, "from-env"},
+		{latest.SecretSource{Env: "KRUISE_TEST_UNSET"}, ""},
+		{latest.SecretSource{File: file}, "from-file"},
+		{latest.SecretSource{Command: "echo from-command"}, "from-command"},
+		{latest.SecretSource{}, ""},
+	}
+	for _, tt := range tests {
+		actual, err := resolveSecretSource(tt.src)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, actual)
+	}
+	_, err := resolveSecretSource(latest.SecretSource{File: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+	_, err = resolveSecretSource(latest.SecretSource{Command: "exit 1"})
+	assert.Error(t, err)
+}
+
+func TestResolveCredentialsFromDockerConfig(t *testing.T) {
+	InitializeLogger()
+	cfg := filepath.Join(t.TempDir(), "config.json")
+	// dXNlcjpwYXNz is user:pass
+	content := `{"auths": {"https://registry.example.com/v1/": {"auth": "dXNlcjpwYXNz"}}}`
+	assert.NoError(t, os.WriteFile(cfg, []byte(content), 0600))
+	u, p, err := resolveCredentials(latest.Credentials{DockerConfig: cfg}, "registry.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", u)
+	assert.Equal(t, "pass", p)
+	u, p, err = resolveCredentials(latest.Credentials{
+		Username:     latest.SecretSource{Value: "ci"},
+		DockerConfig: cfg,
+	}, "registry.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", u)
+	assert.Equal(t, "pass", p)
+	u, p, err = resolveCredentials(latest.Credentials{DockerConfig: cfg}, "other.example.com")
+	assert.NoError(t, err)
+	assert.Empty(t, u)
+	assert.Empty(t, p)
+}
+
+func TestPromptCredentialsShared(t *testing.T) {
+	InitializeLogger()
+	counter := filepath.Join(t.TempDir(), "counter")
+	creds := latest.Credentials{
+		Username: latest.SecretSource{Value: "ci"},
+		Password: latest.SecretSource{Command: "echo >> " + counter + "; echo shared-pass"},
+	}
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("non-interactive", true, "")
+	u, p := promptCredentials(fs, creds, "ghcr.io", "the ghcr.io registry")
+	assert.Equal(t, "ci", u)
+	assert.Equal(t, "shared-pass", p)
+	u, p = promptCredentials(fs, creds, "https://ghcr.io/charts", "the charts Helm repository")
+	assert.Equal(t, "ci", u)
+	assert.Equal(t, "shared-pass", p)
+	b, err := os.ReadFile(counter)
+	assert.NoError(t, err)
+	assert.Equal(t, "\n", string(b), "credentials shared by a host should only be resolved once")
+
+	creds.Username.Value = "other"
+	u, _ = promptCredentials(fs, creds, "ghcr.io", "the ghcr.io registry")
+	assert.Equal(t, "other", u)
+}
@@ -0,0 +1,227 @@
+package kruise
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/adrg/xdg"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// decryptedFiles keeps track of the plaintext copies of SOPS encrypted files
+// made during a run so that each file is only decrypted once and every copy
+// can be removed when the run is over
+type decryptedFiles struct {
+	mu    sync.Mutex
+	dir   string
+	files map[string]string
+}
+
+// encryptedPrefix marks a config value as age encrypted
+const encryptedPrefix = "encrypted:"
+
+// decrypted is the global record of decrypted files used by Kruise
+var decrypted = &decryptedFiles{files: make(map[string]string)}
+
+// isEncrypted is used to determine whether a config value is age encrypted
+func isEncrypted(v string) bool {
+	return strings.HasPrefix(v, encryptedPrefix)
+}
+
+// decryptValue is used to decrypt a config value with the encrypted: prefix
+// using the available age identities
+//
+// The ciphertext may either be ASCII armored or base64 encoded. Values without
+// the prefix are returned as-is and decrypted values are registered as
+// sensitive.
+func decryptValue(v string) (string, error) {
+	if !isEncrypted(v) {
+		return v, nil
+	}
+	ct := []byte(strings.TrimSpace(strings.TrimPrefix(v, encryptedPrefix)))
+	if !bytes.HasPrefix(ct, []byte(armor.Header)) {
+		b, err := base64.StdEncoding.DecodeString(string(ct))
+		if err != nil {
+			return "", fmt.Errorf("encrypted value is neither armored nor base64: %w", err)
+		}
+		ct = b
+	}
+	out, err := ageDecrypt(ct)
+	if err != nil {
+		return "", err
+	}
+	registerSecret(string(out))
+	return string(out), nil
+}
+
+// ageDecrypt is used to decrypt ASCII armored or binary age ciphertext using
+// the available age identities
+func ageDecrypt(ct []byte) ([]byte, error) {
+	ids, err := ageIdentities()
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = bytes.NewReader(ct)
+	if bytes.HasPrefix(bytes.TrimSpace(ct), []byte(armor.Header)) {
+		r = armor.NewReader(bytes.NewReader(bytes.TrimSpace(ct)))
+	}
+	dr, err := age.Decrypt(r, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(dr)
+}
+
+// ageIdentities is used to load the age identities used to decrypt values
+//
+// The same sources as SOPS are used: the SOPS_AGE_KEY environment variable,
+// the file named by SOPS_AGE_KEY_FILE and xdg.ConfigHome/sops/age/keys.txt.
+func ageIdentities() ([]age.Identity, error) {
+	var ids []age.Identity
+	if k := os.Getenv("SOPS_AGE_KEY"); k != "" {
+		parsed, err := age.ParseIdentities(strings.NewReader(k))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOPS_AGE_KEY: %w", err)
+		}
+		ids = append(ids, parsed...)
+	}
+	files := []string{filepath.Join(xdg.ConfigHome, "sops", "age", "keys.txt")}
+	if f := os.Getenv("SOPS_AGE_KEY_FILE"); f != "" {
+		files = []string{expandHome(f)}
+	}
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := age.ParseIdentities(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("invalid age key file %s: %w", f, err)
+		}
+		ids = append(ids, parsed...)
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("no age identity found; set SOPS_AGE_KEY or SOPS_AGE_KEY_FILE")
+	}
+	return ids, nil
+}
+
+// isSOPSEncrypted is used to determine whether a YAML or JSON document was
+// encrypted by SOPS, which adds a top level sops key holding its metadata
+func isSOPSEncrypted(b []byte) bool {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return false
+	}
+	meta, ok := doc["sops"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = meta["mac"]
+	return ok
+}
+
+// decryptFile is used to get the path of a plaintext copy of the given file
+// if it was encrypted by SOPS
+//
+// Files that aren't encrypted are returned as-is. Plaintext copies are only
+// readable by the current user and are removed by removeDecryptedFiles, which
+// also runs when Kruise exits on a fatal error.
+func decryptFile(path string) (string, error) {
+	decrypted.mu.Lock()
+	defer decrypted.mu.Unlock()
+	if p, ok := decrypted.files[path]; ok {
+		return p, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil || !isSOPSEncrypted(b) {
+		// let the tool reading the file report any error
+		return path, nil
+	}
+	out, err := sopsDecrypt(path)
+	if err != nil {
+		return "", err
+	}
+	if decrypted.dir == "" {
+		decrypted.dir, err = os.MkdirTemp("", "kruise-decrypted-")
+		if err != nil {
+			return "", err
+		}
+		// plaintext copies must not outlive the run, even if it fails
+		atExit(removeDecryptedFiles)
+	}
+	p := filepath.Join(decrypted.dir, fmt.Sprintf("%d-%s", len(decrypted.files), filepath.Base(path)))
+	if err := os.WriteFile(p, out, 0600); err != nil {
+		return "", err
+	}
+	Logger.Debugf("Decrypted %s to %s", path, p)
+	decrypted.files[path] = p
+	return p, nil
+}
+
+// decryptedValuesFile is used to get the path passed to Helm for a values
+// file, decrypting it first if it was encrypted by SOPS
+func decryptedValuesFile(path string) string {
+	p, err := decryptFile(path)
+	if err != nil {
+		Logger.Fatalf("Unable to decrypt %s: %v", path, err)
+	}
+	return p
+}
+
+// removeDecryptedFiles is used to remove the plaintext copies of any files
+// decrypted during the run
+func removeDecryptedFiles() {
+	decrypted.mu.Lock()
+	defer decrypted.mu.Unlock()
+	if decrypted.dir == "" {
+		return
+	}
+	if err := os.RemoveAll(decrypted.dir); err != nil {
+		Logger.Warn(err)
+	}
+	decrypted.dir = ""
+	decrypted.files = make(map[string]string)
+}
+
+// decryptConfig is used to replace a SOPS encrypted config that viper has read
+// in with its decrypted contents, which are never written to disk
+func decryptConfig(cfgFile string) {
+	if isURL(cfgFile) {
+		Logger.Fatalf("A SOPS encrypted config must be a local file: %s", cfgFile)
+	}
+	Logger.Debugf("Decrypting config file: %s", cfgFile)
+	out, err := sopsDecrypt(cfgFile)
+	if err != nil {
+		Logger.Fatalf("Unable to decrypt %s: %v", cfgFile, err)
+	}
+	if err := viper.ReadConfig(bytes.NewReader(out)); err != nil {
+		Logger.Fatal(err)
+	}
+}
+
+// sopsDecrypt is used to execute a sops --decrypt command for the given file
+// and return the plaintext
+func sopsDecrypt(path string) ([]byte, error) {
+	if _, err := exec.LookPath("sops"); err != nil {
+		return nil, errors.New("sops must be installed to decrypt SOPS encrypted files")
+	}
+	return NewCmd("sops").
+		WithArgs([]string{"--decrypt", path}).
+		Build().
+		Output()
+}
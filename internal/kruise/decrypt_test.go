@@ -0,0 +1,101 @@
+package kruise
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecryptValue(t *testing.T) {
+	isolateSecrets(t)
+	id, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	t.Setenv("SOPS_AGE_KEY_FILE", "/nonexistent/keys.txt")
+	encrypt := func(w io.Writer) {
+		ew, err := age.Encrypt(w, id.Recipient())
+		assert.NoError(t, err)
+		_, err = ew.Write([]byte("s3cret"))
+		assert.NoError(t, err)
+		assert.NoError(t, ew.Close())
+	}
+
+	var raw bytes.Buffer
+	encrypt(&raw)
+	v, err := decryptValue(encryptedPrefix + base64.StdEncoding.EncodeToString(raw.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", v)
+
+	var armored bytes.Buffer
+	aw := armor.NewWriter(&armored)
+	encrypt(aw)
+	assert.NoError(t, aw.Close())
+	v, err = decryptValue(encryptedPrefix + "\n" + armored.String())
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", v)
+	assert.Equal(t, "password=***", redact("password=s3cret"))
+
+	v, err = decryptValue("plain")
+	assert.NoError(t, err)
+	assert.Equal(t, "plain", v)
+	_, err = decryptValue(encryptedPrefix + "not base64!")
+	assert.Error(t, err)
+
+	t.Setenv("SOPS_AGE_KEY", "")
+	_, err = decryptValue(encryptedPrefix + base64.StdEncoding.EncodeToString(raw.Bytes()))
+	assert.Error(t, err)
+}
+
+func TestIsSOPSEncrypted(t *testing.T) {
+	assert.True(t, isSOPSEncrypted([]byte("password: ENC[AES256_GCM,data:abc]\nsops:\n  mac: ENC[AES256_GCM,data:def]\n")))
+	assert.True(t, isSOPSEncrypted([]byte(`{"password": "ENC[]", "sops": {"mac": "ENC[]"}}`)))
+	assert.False(t, isSOPSEncrypted([]byte("sops: enabled\n")))
+	assert.False(t, isSOPSEncrypted([]byte("replicas: 2\n")))
+	assert.False(t, isSOPSEncrypted([]byte("- not a map\n")))
+}
+
+func TestDecryptedFilesRemovedOnFailure(t *testing.T) {
+	if os.Getenv("KRUISE_TEST_FAILING_INSTALL") == "1" {
+		InitializeLogger()
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		fs.Bool("dry-run", false, "")
+		c := HelmChart{ChartPath: "chart", ReleaseName: "app", Namespace: "app"}
+		c.Values = []string{os.Getenv("KRUISE_TEST_VALUES")}
+		if err := c.Install(fs, nil); err != nil {
+			Logger.Fatal(err)
+		}
+		return
+	}
+	// stand-ins for sops, which decrypts anything, and helm, which fails to
+	// install anything
+	bin := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "sops"), []byte("#!/bin/sh\necho 'password: s3cret'\n"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "helm"), []byte("#!/bin/sh\n[ $# -eq 0 ]\n"), 0755))
+	values := filepath.Join(t.TempDir(), "values.yaml")
+	assert.NoError(t, os.WriteFile(values, []byte("password: ENC[AES256_GCM,data:abc]\nsops:\n  mac: ENC[AES256_GCM,data:def]\n"), 0644))
+	tmp := t.TempDir()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDecryptedFilesRemovedOnFailure$")
+	cmd.Env = append(os.Environ(),
+		"KRUISE_TEST_FAILING_INSTALL=1",
+		"KRUISE_TEST_VALUES="+values,
+		"TMPDIR="+tmp,
+		"PATH="+bin+string(os.PathListSeparator)+os.Getenv("PATH"),
+	)
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	assert.ErrorAs(t, err, &exitErr, string(out))
+	assert.Contains(t, string(out), "FATA")
+	left, err := filepath.Glob(filepath.Join(tmp, "kruise-decrypted-*"))
+	assert.NoError(t, err)
+	assert.Empty(t, left)
+}
@@ -1,6 +1,8 @@
 package kruise
 
 import (
+	"fmt"
+
 	"github.com/j2udev/kruise/internal/schema/latest"
 	"github.com/spf13/pflag"
 )
@@ -16,16 +18,37 @@ type (
 // Deploy determines passed deployments from args and passes the cobra Cmd
 // FlagSet to the Uninstall function
 func Deploy(fs *pflag.FlagSet, args []string) {
+	defer removeDecryptedFiles()
 	init, err := fs.GetBool("init")
 	if err != nil {
 		Logger.Fatal(err)
 	}
+	dry, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	deps := getPassedDeployments(args)
 	d := getPassedInstallers(args)
+	var i Installers
+	if init {
+		i = getPassedInitInstallers(args)
+	}
+	startReport(fs, "deploy", deps, append(i, d...))
+	// repositories that were already added only need their index refreshed, and
+	// only when they are part of this run; a dry run doesn't look at what was
+	// already added so that its output doesn't depend on the machine
+	if !dry {
+		helmRepoUpdate(fs, staleHelmRepositories(append(i, d...)...)...)
+	}
+	// ask every question before anything is installed
+	Prepare(fs, append(i, d...)...)
+	runHooks(fs, deps, preDeploy)
 	if init {
-		i := getPassedInitInstallers(args)
 		Init(fs, i...)
 	}
 	Install(fs, d...)
+	runHooks(fs, deps, postDeploy)
+	finishReport()
 }
 
 // GetDeployments gets deployments from Kruise config
@@ -48,9 +71,62 @@ func GetDeployProfiles() Profiles {
 
 // Delete determines passed deployments from args and passes the cobra Cmd
 // FlagSet to the Uninstall function
+//
+// Helm repositories that are still used by deployments that aren't being
+// deleted are kept, as are all secrets and repositories if the keep-secrets
+// and keep-repos flags are set.
 func Delete(fs *pflag.FlagSet, args []string) {
-	d := getPassedInstallers(args)
+	keepSecrets, err := fs.GetBool("keep-secrets")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	keepRepos, err := fs.GetBool("keep-repos")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	deps := getPassedDeployments(args)
+	inUse := helmRepositoriesInUse(deps)
+	passed := getPassedInstallers(args)
+	// anything that is kept is reported as skipped
+	startReport(fs, "delete", deps, passed)
+	var d Installers
+	for _, i := range passed {
+		switch i := i.(type) {
+		case HelmRepository:
+			if keepRepos || inUse[i.Name] {
+				Logger.Debugf("Keeping the %s Helm repository", i.Name)
+				continue
+			}
+		case secretInstaller:
+			if keepSecrets {
+				continue
+			}
+		}
+		d = append(d, i)
+	}
+	runHooks(fs, deps, preDelete)
 	Uninstall(fs, d...)
+	runHooks(fs, deps, postDelete)
+	finishReport()
+}
+
+// helmRepositoriesInUse is used to get the names of the Helm repositories used
+// by the deployments that aren't given
+func helmRepositoriesInUse(deps Deployments) map[string]bool {
+	passed := make(map[string]bool)
+	for _, d := range deps {
+		passed[d.Name] = true
+	}
+	inUse := make(map[string]bool)
+	for _, d := range GetDeployments() {
+		if passed[d.Name] {
+			continue
+		}
+		for _, r := range d.Helm.Repositories {
+			inUse[r.Name] = true
+		}
+	}
+	return inUse
 }
 
 // newDeployment is a helper function for creating a Deployment object from schema
@@ -86,52 +162,41 @@ func getPassedInitInstallers(args []string) Installers {
 }
 
 // getAllPassedInstallers gets all passed installers given passed arguments
+//
+// Secrets that are the same apart from their namespace are merged into one
+// Installer that creates them in every namespace. Everything keeps the order
+// it was first passed in.
 func getAllPassedInstallers(args []string) Installers {
 	deps := getPassedDeployments(args)
 	var installers Installers
 	var preInstallers Installers
 	var postInstallers Installers
 	repoMap := make(map[string]Installer)
-	gsecretMap := make(map[string]KubectlGenericSecret)
-	dsecretMap := make(map[string]KubectlDockerRegistrySecret)
+	secrets := &secretSet{index: make(map[string]int)}
 	chartMap := make(map[string]Installer)
 	manifestMap := make(map[string]Installer)
+	kustomizationMap := make(map[string]Installer)
+	execMap := make(map[string]Installer)
 	for _, d := range deps {
 		helmDeployment := newHelmDeployment(d.Helm)
 		kubectlDeployment := newKubectlDeployment(d.Kubectl)
 		repositories := helmDeployment.getHelmRepositories()
-		genericSecrets := kubectlDeployment.getKubectlGenericSecrets()
-		dockerRegistrySecrets := kubectlDeployment.getKubectlDockerRegistrySecrets()
 		cha := helmDeployment.getHelmCharts()
-		man := kubectlDeployment.getKubectlManifests()
+		man := kubectlDeployment.getKubectlManifests().forDeployment(d)
+		kus := kubectlDeployment.getKubectlKustomizations()
+		exe := d.getExecs()
 		for _, r := range repositories {
 			if _, ok := repoMap[r.hash()]; !ok {
 				repoMap[r.hash()] = r
 				preInstallers = append(preInstallers, repoMap[r.hash()])
 			}
 		}
-		for _, s := range genericSecrets {
-			hashedSecret := s.hash()
-			if val, ok := gsecretMap[hashedSecret]; ok {
-				if !contains[string](val.Namespaces, s.Namespace) {
-					val.Namespaces = append(val.Namespaces, s.Namespace)
-				}
-				gsecretMap[hashedSecret] = val
-			} else {
-				gsecretMap[hashedSecret] = s
-			}
-		}
-		for _, s := range dockerRegistrySecrets {
-			hashedSecret := s.hash()
-			if val, ok := dsecretMap[hashedSecret]; ok {
-				if !contains[string](val.Namespaces, s.Namespace) {
-					val.Namespaces = append(val.Namespaces, s.Namespace)
-				}
-				dsecretMap[hashedSecret] = val
-			} else {
-				dsecretMap[hashedSecret] = s
-			}
-		}
+		addSecrets(secrets, kubectlDeployment.getKubectlGenericSecrets())
+		addSecrets(secrets, kubectlDeployment.getKubectlDockerRegistrySecrets())
+		addSecrets(secrets, kubectlDeployment.getKubectlTLSSecrets())
+		addSecrets(secrets, kubectlDeployment.getKubectlBasicAuthSecrets())
+		addSecrets(secrets, kubectlDeployment.getKubectlSSHAuthSecrets())
+		addSecrets(secrets, kubectlDeployment.getKubectlServiceAccountTokenSecrets())
 		for _, c := range cha {
 			if _, ok := chartMap[c.hash()]; !ok {
 				chartMap[c.hash()] = c
@@ -144,18 +209,76 @@ func getAllPassedInstallers(args []string) Installers {
 				postInstallers = append(postInstallers, m)
 			}
 		}
+		for _, k := range kus {
+			if _, ok := kustomizationMap[k.hash()]; !ok {
+				kustomizationMap[k.hash()] = k
+				postInstallers = append(postInstallers, k)
+			}
+		}
+		for _, e := range exe {
+			if _, ok := execMap[e.hash()]; !ok {
+				execMap[e.hash()] = e
+				postInstallers = append(postInstallers, e)
+			}
+		}
 	}
-	for _, v := range gsecretMap {
-		preInstallers = append(preInstallers, v)
-	}
-	for _, v := range dsecretMap {
-		preInstallers = append(preInstallers, v)
-	}
+	preInstallers = append(preInstallers, secrets.installers...)
 	installers = append(installers, preInstallers...)
 	installers = append(installers, postInstallers...)
 	return installers
 }
 
+// secretSet is used to merge secrets that are the same apart from their
+// namespace, in the order they were first added
+type secretSet struct {
+	installers Installers
+	index      map[string]int
+}
+
+// addSecrets is used to add secrets of one kind to a secretSet, adding the
+// namespaces of any secret that is already in it to the existing one
+func addSecrets[S secretInstaller, P interface {
+	*S
+	hash() string
+	addNamespaces([]string)
+}](set *secretSet, secrets []S) {
+	for _, s := range secrets {
+		key, _ := mergeKey(s)
+		n, ok := set.index[key]
+		if !ok {
+			set.index[key] = len(set.installers)
+			set.installers = append(set.installers, s)
+			continue
+		}
+		merged := set.installers[n].(S)
+		P(&merged).addNamespaces(s.namespaces())
+		set.installers[n] = merged
+	}
+}
+
+// mergeKey is used to identify a secret by its kind and hash, which leaves
+// out its namespaces so that the same secret is merged across them
+func mergeKey(i Installer) (string, bool) {
+	var h string
+	switch s := i.(type) {
+	case KubectlGenericSecret:
+		h = s.hash()
+	case KubectlDockerRegistrySecret:
+		h = s.hash()
+	case KubectlTLSSecret:
+		h = s.hash()
+	case KubectlBasicAuthSecret:
+		h = s.hash()
+	case KubectlSSHAuthSecret:
+		h = s.hash()
+	case KubectlServiceAccountTokenSecret:
+		h = s.hash()
+	default:
+		return "", false
+	}
+	return fmt.Sprintf("%T/%s", i, h), true
+}
+
 // getPassedDeployments gets all passed deployments given passed arguments
 // func getPassedDeployments(args []string) map[string]Deployment {
 func getPassedDeployments(args []string) Deployments {
@@ -180,13 +303,9 @@ func deduplicateArgs(args []string) []string {
 	var dedup []string
 	for _, a := range args {
 		if p, ok := argIsProfile(a); ok {
-			if !containsAny(dedup, p.Items...) {
-				dedup = append(dedup, p.Items...)
-			} else {
-				for _, item := range p.Items {
-					if !contains(dedup, item) {
-						dedup = append(dedup, item)
-					}
+			for _, item := range p.deployments() {
+				if !contains(dedup, item) {
+					dedup = append(dedup, item)
 				}
 			}
 		} else if dep, ok := argIsDeployment(a); ok {
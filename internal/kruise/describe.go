@@ -0,0 +1,204 @@
+package kruise
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+// installerOrigin represents a deployment that an Installer came from, along
+// with the namespaces it wanted a secret in
+type installerOrigin struct {
+	deployment string
+	namespaces []string
+}
+
+// Describe prints what deploying the passed deployments and profiles would do:
+// the deployments that profiles expand to, the hooks that run and the
+// deduplicated Installers in the order they run, with the deployment each one
+// came from
+//
+// Secrets that more than one deployment wants are merged into one Installer
+// for every namespace, which is shown separately.
+func Describe(fs *pflag.FlagSet, args []string) {
+	if err := writeDescription(redactWriter{os.Stdout}, args); err != nil {
+		Logger.Fatal(err)
+	}
+}
+
+// writeDescription is used to write the description of the given deployments
+// and profiles
+func writeDescription(out io.Writer, args []string) error {
+	deps := getPassedDeployments(args)
+	origins := installerOrigins(deps)
+	init := getPassedInitInstallers(args)
+	installers := getPassedInstallers(args)
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "Deployments: %s\n", strings.Join(deduplicateArgs(args), ", "))
+	for _, a := range args {
+		if p, ok := argIsProfile(a); ok {
+			fmt.Fprintf(w, "  %s (profile): %s\n", p.Name, strings.Join(p.deployments(), ", "))
+		} else if d, ok := argIsDeployment(a); ok {
+			fmt.Fprintf(w, "  %s\n", d.Name)
+		}
+	}
+
+	step := 1
+	step = describeHooks(w, "Pre-deploy hooks", deps, preDeploy, step)
+	if len(init) > 0 {
+		fmt.Fprintln(w, "\nInit installers (only with --init):")
+		step = describeInstallers(w, init, origins, step)
+	}
+	fmt.Fprintln(w, "\nInstallers:")
+	step = describeInstallers(w, installers, origins, step)
+	describeHooks(w, "Post-deploy hooks", deps, postDeploy, step)
+	describeMerged(w, append(init, installers...), origins)
+	return w.Flush()
+}
+
+// describeHooks is used to write a row per hook of the given event, returning
+// the next step number
+func describeHooks(w io.Writer, title string, deps Deployments, event string, step int) int {
+	var rows []string
+	for _, d := range deps {
+		for _, h := range d.hooks(event) {
+			var what []string
+			if h.Command != "" {
+				what = append(what, "command: "+h.Command)
+			}
+			if len(h.Manifest.Paths) > 0 {
+				what = append(what, "manifest: "+strings.Join(h.Manifest.Paths, ", "))
+			}
+			if h.Job != "" {
+				what = append(what, "job: "+h.Job)
+			}
+			rows = append(rows, fmt.Sprintf("  %d\t%s\t%s\n", step, d.Name, strings.Join(what, "; ")))
+			step++
+		}
+	}
+	if len(rows) > 0 {
+		fmt.Fprintf(w, "\n%s:\n", title)
+		fmt.Fprintln(w, "  STEP\tDEPLOYMENT\tHOOK")
+		for _, r := range rows {
+			fmt.Fprint(w, r)
+		}
+	}
+	return step
+}
+
+// describeInstallers is used to write a row per Installer in the order they
+// run, followed by the batches they run in with --concurrent, returning the
+// next step number
+//
+// Repositories and secrets always run before everything else, and batches run
+// in ascending order of priority.
+func describeInstallers(w io.Writer, installers Installers, origins map[string][]installerOrigin, step int) int {
+	var pre, post Installers
+	for _, i := range installers {
+		switch i.(type) {
+		case HelmChart, KubectlManifest, KubectlKustomization, Exec:
+			post = append(post, i)
+		default:
+			pre = append(pre, i)
+		}
+	}
+	fmt.Fprintln(w, "  STEP\tPRIORITY\tTYPE\tNAME\tNAMESPACE\tDEPLOYMENT")
+	for _, i := range append(pre, post...) {
+		typ, name, ns := describe(i)
+		if ns == "" {
+			ns = "-"
+		}
+		var from []string
+		for _, o := range origins[originKey(i)] {
+			from = append(from, o.deployment)
+		}
+		fmt.Fprintf(w, "  %d\t%d\t%s\t%s\t%s\t%s\n", step, i.GetPriority(), typ, name, ns, orNone(from))
+		step++
+	}
+	fmt.Fprintln(w, "  With --concurrent, each batch runs at once:")
+	for _, b := range append(batches(pre), batches(post)...) {
+		fmt.Fprintf(w, "    %s\n", b)
+	}
+	return step
+}
+
+// describeMerged is used to write the secrets that were merged from more than
+// one deployment, with the namespaces each deployment wanted them in
+func describeMerged(w io.Writer, installers Installers, origins map[string][]installerOrigin) {
+	var rows []string
+	for _, i := range installers {
+		typ, name, ns := describe(i)
+		origin := origins[originKey(i)]
+		if typ != "secret" || len(origin) < 2 {
+			continue
+		}
+		var from []string
+		for _, o := range origin {
+			from = append(from, fmt.Sprintf("%s (%s)", o.deployment, strings.Join(o.namespaces, ", ")))
+		}
+		rows = append(rows, fmt.Sprintf("  %s\t%s\t%s\n", name, ns, strings.Join(from, ", ")))
+	}
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nMerged secrets:")
+	fmt.Fprintln(w, "  NAME\tNAMESPACES\tDEPLOYMENTS")
+	for _, r := range rows {
+		fmt.Fprint(w, r)
+	}
+}
+
+// batches is used to describe the priority batches that the given Installers
+// run in with --concurrent
+func batches(installers Installers) []string {
+	m := priorityMap(installers...)
+	var keys []int
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	var b []string
+	for _, k := range keys {
+		var names []string
+		for _, i := range m[k] {
+			typ, name, _ := describe(i)
+			names = append(names, typ+" "+name)
+		}
+		b = append(b, fmt.Sprintf("priority %d: %s", k, strings.Join(names, ", ")))
+	}
+	return b
+}
+
+// installerOrigins is used to get the deployments that each Installer of the
+// given deployments came from, in the order the deployments were passed
+//
+// An Installer that more than one deployment has is only installed once, as
+// part of the first of them.
+func installerOrigins(deps Deployments) map[string][]installerOrigin {
+	origins := make(map[string][]installerOrigin)
+	for _, d := range deps {
+		for _, i := range getAllPassedInstallers([]string{d.Name}) {
+			_, _, ns := describe(i)
+			k := originKey(i)
+			origins[k] = append(origins[k], installerOrigin{deployment: d.Name, namespaces: strings.Split(ns, ", ")})
+		}
+	}
+	return origins
+}
+
+// originKey is used to identify an Installer across deployments
+//
+// Secrets are identified the same way they are merged, by their kind and
+// hash, so that secrets that only share a name aren't reported as merged.
+func originKey(i Installer) string {
+	if k, ok := mergeKey(i); ok {
+		return k
+	}
+	typ, name, ns := describe(i)
+	return typ + "/" + ns + "/" + name
+}
@@ -0,0 +1,46 @@
+package kruise
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeMerged(t *testing.T) {
+	InitializeLogger()
+	secret := func(ns string, val string) latest.KubectlDeployment {
+		var k latest.KubectlDeployment
+		k.Secrets.Generic = []latest.KubectlGenericSecret{{Name: "creds", Namespace: ns, Literal: []latest.KeyVal{{Key: "password", Val: val}}}}
+		return k
+	}
+	old := Kfg
+	Kfg = &Konfig{}
+	Kfg.Manifest.Deploy.Deployments = []latest.Deployment{
+		{Name: "grafana", Kubectl: secret("monitoring", "s3cret")},
+		{Name: "loki", Kubectl: secret("logging", "s3cret")},
+		{Name: "jaeger", Kubectl: secret("tracing", "other")},
+	}
+	t.Cleanup(func() { Kfg = old })
+	args := []string{"grafana", "loki", "jaeger"}
+	var buf bytes.Buffer
+	describeMerged(&buf, getAllPassedInstallers(args), installerOrigins(getPassedDeployments(args)))
+	assert.Contains(t, buf.String(), "creds\tmonitoring, logging\tgrafana (monitoring), loki (logging)\n")
+	assert.NotContains(t, buf.String(), "jaeger", "a secret that only shares a name isn't merged")
+}
+
+func TestWriteDescriptionNestedProfile(t *testing.T) {
+	InitializeLogger()
+	old := Kfg
+	Kfg = &Konfig{}
+	Kfg.Manifest.Deploy.Deployments = []latest.Deployment{{Name: "istio"}, {Name: "jaeger"}, {Name: "grafana"}}
+	Kfg.Manifest.Deploy.Profiles = []latest.Profile{
+		{Name: "mesh", Items: []string{"istio"}},
+		{Name: "observability", Items: []string{"mesh", "jaeger", "grafana"}},
+	}
+	t.Cleanup(func() { Kfg = old })
+	var buf bytes.Buffer
+	assert.NoError(t, writeDescription(&buf, []string{"observability"}))
+	assert.Contains(t, buf.String(), "  observability (profile): istio, jaeger, grafana\n")
+}
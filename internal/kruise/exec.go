@@ -0,0 +1,139 @@
+package kruise
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+)
+
+type (
+	// Exec represents an arbitrary tool that is installed and uninstalled with
+	// shell commands
+	Exec latest.Exec
+	// Execs represents a slice of Exec objects
+	Execs []Exec
+)
+
+// Install is used to run the install command of the Exec
+func (e Exec) Install(fs *pflag.FlagSet, out io.Writer) error {
+	return e.run(fs, out, e.InstallCommand)
+}
+
+// Uninstall is used to run the uninstall command of the Exec
+func (e Exec) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	if e.UninstallCommand == "" {
+		Logger.Debugf("%s has no uninstall command", e.Name)
+		return nil
+	}
+	return e.run(fs, out, e.UninstallCommand)
+}
+
+// GetPriority is used to get the priority of the installer
+func (e Exec) GetPriority() int {
+	return e.Priority
+}
+
+// IsInit is used to determine whether the installer should be installed during
+// initialization
+func (e Exec) IsInit() bool {
+	return e.Init
+}
+
+// newExec is a helper function for dealing with the latest.Exec to Exec type
+// definition
+func newExec(ex latest.Exec) Exec {
+	return Exec(ex)
+}
+
+// newExecs is a helper function for dealing with the latest.Exec to Exec type
+// definition
+func newExecs(exs []latest.Exec) Execs {
+	var e Execs
+	for _, ex := range exs {
+		e = append(e, newExec(ex))
+	}
+	return e
+}
+
+// getExecs is a helper function for grabbing the Execs from a Deployment
+func (d Deployment) getExecs() Execs {
+	return newExecs(d.Exec)
+}
+
+// run is used to run the given shell command in the working directory and
+// environment of the Exec, streaming its output as it runs
+//
+// An error carrying the exit code of the command is returned if it fails.
+func (e Exec) run(fs *pflag.FlagSet, out io.Writer, command string) error {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if command == "" {
+		return fmt.Errorf("%s has no command to run", e.Name)
+	}
+	env, err := e.env(d)
+	if err != nil {
+		return fmt.Errorf("unable to set the environment of %s: %w", e.Name, err)
+	}
+	err = NewCmd("sh").
+		WithArgs([]string{"-c", command}).
+		WithEnv(env).
+		WithDir(e.Dir).
+		WithDryRun(d).
+		WithOutput(out).
+		Build().
+		Stream()
+	if err != nil {
+		return fmt.Errorf("%s: %w", e.Name, err)
+	}
+	return nil
+}
+
+// env is used to build the KEY=value environment variables of the Exec
+//
+// Values may be secret references or encrypted, which are resolved and
+// registered as sensitive; like other secrets, they aren't resolved during a
+// dry run.
+func (e Exec) env(dry bool) ([]string, error) {
+	var env []string
+	for _, kv := range e.Env {
+		v := kv.Val
+		switch {
+		case dry && (kv.Ref != "" || isEncrypted(kv.Val)):
+			v = redacted
+		case kv.Ref != "":
+			var err error
+			v, err = resolveSecretRef(kv.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", kv.Key, err)
+			}
+		case isEncrypted(kv.Val):
+			var err error
+			v, err = decryptValue(kv.Val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", kv.Key, err)
+			}
+		}
+		env = append(env, kv.Key+"="+v)
+	}
+	return env, nil
+}
+
+// hash is used to facilitate storing Execs in a map
+//
+// Every field is hashed, since Execs that differ in any of them behave
+// differently.
+func (e *Exec) hash() string {
+	h := sha1.New()
+	h.Write([]byte(e.Name + "\x00" + e.InstallCommand + "\x00" + e.UninstallCommand + "\x00" + e.Dir + "\x00"))
+	for _, kv := range e.Env {
+		h.Write([]byte(kv.Key + "\x00" + kv.Val + "\x00" + kv.Ref + "\x00"))
+	}
+	fmt.Fprintf(h, "%d\x00%t\x00", e.Priority, e.Init)
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,82 @@
+package kruise
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecInstall(t *testing.T) {
+	InitializeLogger()
+	sh, err := exec.LookPath("sh")
+	require.NoError(t, err)
+	dir := t.TempDir()
+	e := newExec(latest.Exec{
+		Name:           "kind",
+		InstallCommand: `echo "$CLUSTER in $(pwd)"`,
+		Env: []latest.KeyVal{
+			{Key: "CLUSTER", Val: "dev"},
+			{Key: "TOKEN", Ref: "vault://secret/kind#token"},
+		},
+		Dir: dir,
+	})
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", true, "")
+	out := captureStdout(func() { e.Install(fs, nil) })
+	assert.Equal(t, "cd "+dir+" && CLUSTER=dev TOKEN=*** "+sh+` -c echo "$CLUSTER in $(pwd)"`+"\n", out)
+
+	e.Env = e.Env[:1]
+	require.NoError(t, fs.Set("dry-run", "false"))
+	out = captureStdout(func() { e.Install(fs, nil) })
+	assert.Equal(t, "dev in "+dir+"\n", out)
+	out = captureStdout(func() { e.Uninstall(fs, nil) })
+	assert.Empty(t, out)
+}
+
+func TestExecFailure(t *testing.T) {
+	InitializeLogger()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", false, "")
+	var buf bytes.Buffer
+	err := newExec(latest.Exec{Name: "kind", InstallCommand: "echo creating; echo oops >&2; exit 3"}).Install(fs, &buf)
+	assert.EqualError(t, err, "kind: exit status 3")
+	assert.Equal(t, 3, exitCode(err))
+	assert.Equal(t, "creating\noops\n", buf.String())
+}
+
+func TestLineWriter(t *testing.T) {
+	isolateSecrets(t)
+	registerSecret("hunter2")
+	var buf bytes.Buffer
+	w := &lineWriter{w: redactWriter{&buf}}
+	for _, p := range []string{"password=hun", "ter2\nnext", " line"} {
+		_, err := w.Write([]byte(p))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "password=***\n", buf.String(), "only whole lines should be written")
+	require.NoError(t, w.flush())
+	assert.Equal(t, "password=***\nnext line", buf.String())
+}
+
+func TestExecHash(t *testing.T) {
+	base := latest.Exec{Name: "kind", InstallCommand: "kind create cluster", Env: []latest.KeyVal{{Key: "KIND_EXPERIMENTAL_PROVIDER", Val: "podman"}}}
+	e := newExec(base)
+	same := newExec(base)
+	assert.Equal(t, e.hash(), same.hash())
+	for name, change := range map[string]func(*latest.Exec){
+		"env":       func(x *latest.Exec) { x.Env = []latest.KeyVal{{Key: "KIND_EXPERIMENTAL_PROVIDER", Val: "docker"}} },
+		"uninstall": func(x *latest.Exec) { x.UninstallCommand = "kind delete cluster" },
+		"priority":  func(x *latest.Exec) { x.Priority = 2 },
+		"init":      func(x *latest.Exec) { x.Init = true },
+	} {
+		ex := base
+		change(&ex)
+		other := newExec(ex)
+		assert.NotEqual(t, e.hash(), other.hash(), name)
+	}
+}
@@ -4,12 +4,17 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 
 	"github.com/j2udev/kruise/internal/schema/latest"
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
 type (
@@ -26,48 +31,80 @@ type (
 	HelmRepositories []HelmRepository
 	// HelmCharts represents a slice of HelmChart objects
 	HelmCharts []HelmChart
+	// helmRepositoryConfig represents the parts of the Helm repositories.yaml
+	// file that are needed to determine which repositories were already added
+	helmRepositoryConfig struct {
+		Repositories []struct {
+			Name string `yaml:"name"`
+			URL  string `yaml:"url"`
+		} `yaml:"repositories"`
+	}
 )
 
 // Install is used to execute a Helm install command
-func (c HelmChart) Install(fs *pflag.FlagSet) {
+func (c HelmChart) Install(fs *pflag.FlagSet, out io.Writer) error {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
 	}
 	if !d {
 		checkHelm()
-	}
-	err = helmExecute(d, c.installArgs(fs))
-	if err != nil {
-		if strings.Contains(err.Error(), "deprecated") {
-			if err != nil {
-				Logger.Warn(err)
-			}
-		} else {
-			if err != nil {
-				Logger.Error(err)
-			}
+		if err := c.verifyLock(); err != nil {
+			return err
 		}
 	}
+	err = helmExecute(out, d, c.installArgs(fs))
+	if err != nil && strings.Contains(err.Error(), "deprecated") {
+		Logger.Warn(err)
+		return nil
+	}
+	return err
 }
 
 // Install is used to execute a Helm repo add command
-func (r HelmRepository) Install(fs *pflag.FlagSet) {
+//
+// Repositories that were already added with the same URL are skipped unless
+// forceUpdate is set.
+func (r HelmRepository) Install(fs *pflag.FlagSet, out io.Writer) error {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
 	}
 	if !d {
 		checkHelm()
+		if added, _ := r.added(); added && !r.ForceUpdate {
+			Logger.Infof("Helm repository %s has already been added", r.Name)
+			return nil
+		}
 	}
-	err = helmExecute(d, r.installArgs(fs))
+	args, password := r.installArgs(fs)
+	return NewCmd("helm").
+		WithArgs(args).
+		WithStdin(password).
+		WithDryRun(d).
+		WithOutput(out).
+		Build().
+		Execute()
+}
+
+// prepare is used to prompt for the credentials of a private HelmRepository
+// that needs to be added before anything is installed
+func (r HelmRepository) prepare(fs *pflag.FlagSet) {
+	d, err := fs.GetBool("dry-run")
 	if err != nil {
-		Logger.Error(err)
+		Logger.Fatal(err)
+	}
+	if d || !r.Private {
+		return
 	}
+	if added, _ := r.added(); added && !r.ForceUpdate {
+		return
+	}
+	promptCredentials(fs, r.Credentials, r.Url, fmt.Sprintf("the %s Helm repository", r.Name))
 }
 
 // Uninstall is used to execute a Helm uninstall command
-func (c HelmChart) Uninstall(fs *pflag.FlagSet) {
+func (c HelmChart) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
@@ -75,14 +112,15 @@ func (c HelmChart) Uninstall(fs *pflag.FlagSet) {
 	if !d {
 		checkHelm()
 	}
-	err = helmExecute(d, c.uninstallArgs(fs))
+	err = helmExecute(out, d, c.uninstallArgs(fs))
 	if err != nil {
 		Logger.Warn(err)
 	}
+	return nil
 }
 
 // Uninstall is used to execute a Helm repo remove command
-func (r HelmRepository) Uninstall(fs *pflag.FlagSet) {
+func (r HelmRepository) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
@@ -90,10 +128,7 @@ func (r HelmRepository) Uninstall(fs *pflag.FlagSet) {
 	if !d {
 		checkHelm()
 	}
-	err = helmExecute(d, r.uninstallArgs(fs))
-	if err != nil {
-		Logger.Error(err)
-	}
+	return helmExecute(out, d, r.uninstallArgs(fs))
 }
 
 // GetPriority is used to get the priority of the installer
@@ -171,10 +206,10 @@ func (d HelmDeployment) getHelmCharts() HelmCharts {
 
 // installArgs is used to build Helm install CLI args given a FlagSet
 func (c HelmChart) installArgs(fs *pflag.FlagSet) []string {
-	if c.ChartName == "" {
+	if c.ChartName == "" && c.ChartPath == "" {
 		Logger.Fatal("You must specify a Helm chart name")
 	}
-	if c.RepoName == "" {
+	if c.RepoName == "" && c.ChartPath == "" {
 		Logger.Fatalf("You must specify a Helm repository for %s", c.ChartName)
 	}
 	if c.ReleaseName == "" {
@@ -184,15 +219,24 @@ func (c HelmChart) installArgs(fs *pflag.FlagSet) []string {
 		"upgrade",
 		"--install",
 		c.ReleaseName,
-		c.RepoName + "/" + c.ChartName,
+		c.chart(),
 		"--namespace",
 		c.Namespace,
 	}
-	if c.Version != "" {
-		args = append(args, "--version", c.Version)
+	// a local chart path already identifies the exact chart to install
+	if v := c.version(); v != "" && c.ChartPath == "" {
+		args = append(args, "--version", v)
+	}
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
 	}
 	if len(c.Values) > 0 {
 		for _, val := range c.Values {
+			// SOPS encrypted values files are only decrypted for a real run
+			if !d {
+				val = decryptedValuesFile(val)
+			}
 			args = append(args, "-f", val)
 		}
 	}
@@ -205,6 +249,15 @@ func (c HelmChart) installArgs(fs *pflag.FlagSet) []string {
 	return args
 }
 
+// chart is used to get the chart reference passed to Helm, which is either a
+// local chart path or a chart in a Helm repository
+func (c HelmChart) chart() string {
+	if c.ChartPath != "" {
+		return c.ChartPath
+	}
+	return c.RepoName + "/" + c.ChartName
+}
+
 // uninstallArgs is used to build Helm uninstall CLI args given a FlagSet
 func (c HelmChart) uninstallArgs(fs *pflag.FlagSet) []string {
 	if c.ReleaseName == "" {
@@ -226,7 +279,10 @@ func (c HelmChart) uninstallArgs(fs *pflag.FlagSet) []string {
 }
 
 // installArgs is used to build Helm repo add CLI args given a FlagSet
-func (r HelmRepository) installArgs(fs *pflag.FlagSet) []string {
+//
+// The password of a private repository is returned separately so that it can
+// be passed on stdin rather than as an argument.
+func (r HelmRepository) installArgs(fs *pflag.FlagSet) ([]string, []byte) {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
@@ -242,21 +298,31 @@ func (r HelmRepository) installArgs(fs *pflag.FlagSet) []string {
 		"add",
 		r.Name,
 		r.Url,
-		"--force-update", //TODO: force update as the default behavior is probably overkill; think about adding an override flag or something
-	}
-	if r.Private {
-		u := "***"
-		p := "***"
-		if !d {
-			u = normalInputPrompt(fmt.Sprintf("Please enter your username for the %s Helm repository", r.Name))
-			p = sensitiveInputPrompt(fmt.Sprintf("Please enter your password for the %s Helm repository", r.Name))
-		}
-		args = append(args,
-			"--username", u,
-			"--password", p,
-			"--pass-credentials")
 	}
-	return args
+	// a repository with the same name but a different URL can only be replaced
+	// by forcing the update; a dry run doesn't look at what was already added
+	// so that its output doesn't depend on the machine it runs on
+	var conflict bool
+	if !d {
+		_, conflict = r.added()
+	}
+	if r.ForceUpdate || conflict {
+		args = append(args, "--force-update")
+	}
+	if !r.Private {
+		return args, nil
+	}
+	u := redacted
+	p := redacted
+	if !d {
+		u, p = promptCredentials(fs, r.Credentials, r.Url, fmt.Sprintf("the %s Helm repository", r.Name))
+	}
+	registerSecret(p)
+	args = append(args,
+		"--username", u,
+		"--password-stdin",
+		"--pass-credentials")
+	return args, []byte(p)
 }
 
 // uninstallArgs is used to build Helm repo remove CLI args given a FlagSet
@@ -274,6 +340,7 @@ func (c HelmChart) hash() string {
 	h := sha1.New()
 	h.Write([]byte(c.RepoName))
 	h.Write([]byte(c.ChartName))
+	h.Write([]byte(c.ChartPath))
 	h.Write([]byte(c.ReleaseName))
 	h.Write([]byte(c.Version))
 	for _, v := range c.Values {
@@ -297,31 +364,140 @@ func (r HelmRepository) hash() string {
 	h.Write([]byte(r.Name))
 	h.Write([]byte(r.Url))
 	h.Write([]byte(strconv.FormatBool(r.Private)))
+	h.Write([]byte(strconv.FormatBool(r.ForceUpdate)))
 	return base64.URLEncoding.EncodeToString(h.Sum(nil))
 }
 
-// helmRepoUpdate is used to execute a Helm repo update command
-func helmRepoUpdate(fs *pflag.FlagSet) {
+// added is used to determine whether the HelmRepository has already been
+// added with the same URL, or whether its name conflicts with a repository that
+// was added with a different URL
+func (r HelmRepository) added() (added bool, conflict bool) {
+	b, err := os.ReadFile(helmRepositoryConfigPath())
+	if err != nil {
+		return false, false
+	}
+	var cfg helmRepositoryConfig
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		Logger.Debug(err)
+		return false, false
+	}
+	for _, existing := range cfg.Repositories {
+		if existing.Name == r.Name {
+			same := strings.TrimSuffix(existing.URL, "/") == strings.TrimSuffix(r.Url, "/")
+			return same, !same
+		}
+	}
+	return false, false
+}
+
+// staleHelmRepositories is used to get the names of the already added
+// HelmRepositories that the given HelmCharts are installed from
+//
+// Repositories that are force updated are excluded since re-adding them
+// refreshes their index.
+func staleHelmRepositories(installers ...Installer) []string {
+	var chartRepos []string
+	for _, i := range installers {
+		if c, ok := i.(HelmChart); ok && c.ChartPath == "" {
+			chartRepos = append(chartRepos, c.RepoName)
+		}
+	}
+	var stale []string
+	for _, i := range installers {
+		r, ok := i.(HelmRepository)
+		if !ok || r.ForceUpdate || contains(stale, r.Name) || !contains(chartRepos, r.Name) {
+			continue
+		}
+		if added, _ := r.added(); added {
+			stale = append(stale, r.Name)
+		}
+	}
+	return stale
+}
+
+// helmRepoUpdate is used to execute a Helm repo update command for the given
+// repositories; nothing is updated if no repositories are given
+func helmRepoUpdate(fs *pflag.FlagSet, repos ...string) {
+	if len(repos) == 0 {
+		return
+	}
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
 	}
-	err = helmExecute(d, []string{"repo", "update"})
+	args := append([]string{"repo", "update"}, repos...)
+	err = helmExecute(nil, d, args)
 	if err != nil {
 		Logger.Warn(err)
 	}
 }
 
 // helmExecute is a helper function for executing a Helm command given a set of
-// args; it will print the command instead of executing it if dry is true
-func helmExecute(dry bool, args []string) error {
+// args, writing its output to out; it will print the command instead of
+// executing it if dry is true
+func helmExecute(out io.Writer, dry bool, args []string) error {
 	return NewCmd("helm").
 		WithArgs(args).
 		WithDryRun(dry).
+		WithOutput(out).
 		Build().
 		Execute()
 }
 
+// helmRepositoryConfigPath is used to determine the location of the Helm
+// repositories.yaml file, honoring the HELM_REPOSITORY_CONFIG environment
+// variable
+func helmRepositoryConfigPath() string {
+	if c := os.Getenv("HELM_REPOSITORY_CONFIG"); c != "" {
+		return c
+	}
+	return filepath.Join(helmConfigHome(), "repositories.yaml")
+}
+
+// helmConfigHome is used to determine the directory Helm keeps its config in
+func helmConfigHome() string {
+	return helmHome("HELM_CONFIG_HOME", "XDG_CONFIG_HOME", func(home string) string {
+		switch runtime.GOOS {
+		case "darwin":
+			return filepath.Join(home, "Library", "Preferences")
+		case "windows":
+			return os.Getenv("APPDATA")
+		}
+		return filepath.Join(home, ".config")
+	})
+}
+
+// helmCacheHome is used to determine the directory Helm keeps its cache in
+func helmCacheHome() string {
+	return helmHome("HELM_CACHE_HOME", "XDG_CACHE_HOME", func(home string) string {
+		switch runtime.GOOS {
+		case "darwin":
+			return filepath.Join(home, "Library", "Caches")
+		case "windows":
+			return os.TempDir()
+		}
+		return filepath.Join(home, ".cache")
+	})
+}
+
+// helmHome is used to determine a Helm directory the same way Helm does: from
+// the given Helm environment variable, or else the helm directory of the given
+// XDG environment variable or of the default base directory of the OS
+//
+// Helm doesn't follow the XDG defaults on macOS and Windows, which is why the
+// xdg package can't be used for these.
+func helmHome(helmEnv string, xdgEnv string, osDefault func(home string) string) string {
+	if h := os.Getenv(helmEnv); h != "" {
+		return h
+	}
+	base := os.Getenv(xdgEnv)
+	if base == "" {
+		home, _ := os.UserHomeDir()
+		base = osDefault(home)
+	}
+	return filepath.Join(base, "helm")
+}
+
 // checkHelm is used to determine if the user has the Helm CLI installed
 func checkHelm() {
 	err := exec.Command("helm").Run()
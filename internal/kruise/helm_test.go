@@ -0,0 +1,123 @@
+package kruise
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubHelmRepositories is used to point Helm at a repositories file that has
+// the given contents for the duration of a test
+func stubHelmRepositories(t *testing.T, content string) {
+	path := filepath.Join(t.TempDir(), "repositories.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	t.Setenv("HELM_REPOSITORY_CONFIG", path)
+}
+
+const testHelmRepositories = `apiVersion: ""
+repositories:
+- name: istio
+  url: https://istio-release.storage.googleapis.com/charts/
+- name: prometheus-community
+  url: https://prometheus-community.github.io/helm-charts
+`
+
+func TestHelmRepositoryAdded(t *testing.T) {
+	InitializeLogger()
+	stubHelmRepositories(t, testHelmRepositories)
+	tests := []struct {
+		name     string
+		repo     HelmRepository
+		added    bool
+		conflict bool
+	}{
+		{"same url", HelmRepository{Name: "istio", Url: "https://istio-release.storage.googleapis.com/charts"}, true, false},
+		{"different url", HelmRepository{Name: "prometheus-community", Url: "https://example.com/charts"}, false, true},
+		{"not added", HelmRepository{Name: "jaegertracing", Url: "https://jaegertracing.github.io/helm-charts"}, false, false},
+	}
+	for _, tt := range tests {
+		added, conflict := tt.repo.added()
+		assert.Equal(t, tt.added, added, tt.name)
+		assert.Equal(t, tt.conflict, conflict, tt.name)
+	}
+	t.Setenv("HELM_REPOSITORY_CONFIG", filepath.Join(t.TempDir(), "missing.yaml"))
+	added, conflict := tests[0].repo.added()
+	assert.False(t, added)
+	assert.False(t, conflict)
+}
+
+func TestStaleHelmRepositories(t *testing.T) {
+	InitializeLogger()
+	stubHelmRepositories(t, testHelmRepositories)
+	istio := HelmRepository{Name: "istio", Url: "https://istio-release.storage.googleapis.com/charts/"}
+	prom := HelmRepository{Name: "prometheus-community", Url: "https://prometheus-community.github.io/helm-charts"}
+	jaeger := HelmRepository{Name: "jaegertracing", Url: "https://jaegertracing.github.io/helm-charts"}
+	tests := []struct {
+		name       string
+		installers Installers
+		stale      []string
+	}{
+		{"added and used", Installers{istio, HelmChart{RepoName: "istio", ChartName: "base"}}, []string{"istio"}},
+		{"added but unused", Installers{istio, prom, HelmChart{RepoName: "istio", ChartName: "base"}}, []string{"istio"}},
+		{"not added yet", Installers{jaeger, HelmChart{RepoName: "jaegertracing", ChartName: "jaeger"}}, nil},
+		{"force updated", Installers{HelmRepository{Name: "istio", Url: istio.Url, ForceUpdate: true}, HelmChart{RepoName: "istio", ChartName: "base"}}, nil},
+		{"local chart", Installers{istio, HelmChart{RepoName: "istio", ChartPath: "charts/base.tgz"}}, nil},
+		{"deduplicated", Installers{istio, istio, HelmChart{RepoName: "istio", ChartName: "base"}}, []string{"istio"}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.stale, staleHelmRepositories(tt.installers...), tt.name)
+	}
+}
+
+func TestHelmRepositoryInstallArgs(t *testing.T) {
+	InitializeLogger()
+	stubHelmRepositories(t, testHelmRepositories)
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", false, "")
+	tests := []struct {
+		name string
+		repo HelmRepository
+		args []string
+	}{
+		{"new", HelmRepository{Name: "jaegertracing", Url: "https://jaegertracing.github.io/helm-charts"}, []string{"repo", "add", "jaegertracing", "https://jaegertracing.github.io/helm-charts"}},
+		{"force update", HelmRepository{Name: "jaegertracing", Url: "https://jaegertracing.github.io/helm-charts", ForceUpdate: true}, []string{"repo", "add", "jaegertracing", "https://jaegertracing.github.io/helm-charts", "--force-update"}},
+		{"conflicting url", HelmRepository{Name: "istio", Url: "https://example.com/charts"}, []string{"repo", "add", "istio", "https://example.com/charts", "--force-update"}},
+	}
+	for _, tt := range tests {
+		args, _ := tt.repo.installArgs(fs)
+		assert.Equal(t, tt.args, args, tt.name)
+	}
+	assert.NoError(t, fs.Set("dry-run", "true"))
+	args, _ := HelmRepository{Name: "istio", Url: "https://example.com/charts"}.installArgs(fs)
+	assert.Equal(t, []string{"repo", "add", "istio", "https://example.com/charts"}, args, "a dry run doesn't depend on the added repositories")
+}
+
+func TestHelmPaths(t *testing.T) {
+	for _, env := range []string{"HELM_REPOSITORY_CONFIG", "HELM_REPOSITORY_CACHE", "HELM_CONFIG_HOME", "HELM_CACHE_HOME"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("XDG_CONFIG_HOME", "/xdg/config")
+	t.Setenv("XDG_CACHE_HOME", "/xdg/cache")
+	assert.Equal(t, filepath.Join("/xdg/config", "helm", "repositories.yaml"), helmRepositoryConfigPath())
+	assert.Equal(t, filepath.Join("/xdg/cache", "helm", "repository"), helmRepositoryCache())
+	t.Setenv("HELM_CONFIG_HOME", "/helm/config")
+	t.Setenv("HELM_REPOSITORY_CACHE", "/helm/repository")
+	assert.Equal(t, filepath.Join("/helm/config", "repositories.yaml"), helmRepositoryConfigPath())
+	assert.Equal(t, "/helm/repository", helmRepositoryCache())
+}
+
+func TestHelmRepoUpdate(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", true, "")
+	var buf bytes.Buffer
+	output = &buf
+	t.Cleanup(func() { output = nil })
+	helmRepoUpdate(fs)
+	assert.Empty(t, buf.String())
+	helmRepoUpdate(fs, "istio", "jaegertracing")
+	assert.Contains(t, buf.String(), "helm repo update istio jaegertracing\n")
+}
@@ -0,0 +1,141 @@
+package kruise
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+)
+
+// Hook represents a command, manifest and/or Job that runs around a Deployment
+type Hook latest.Hook
+
+const (
+	// preDeploy hooks run before anything is deployed
+	preDeploy = "preDeploy"
+	// postDeploy hooks run after everything is deployed
+	postDeploy = "postDeploy"
+	// preDelete hooks run before anything is deleted
+	preDelete = "preDelete"
+	// postDelete hooks run after everything is deleted
+	postDelete = "postDelete"
+)
+
+// runHooks is used to run the hooks of the given event for each of the given
+// Deployments in order, exiting if any of them fails
+func runHooks(fs *pflag.FlagSet, deps Deployments, event string) {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	for _, dep := range deps {
+		for _, h := range dep.hooks(event) {
+			Logger.Infof("Running %s hook of %s", event, dep.Name)
+			if err := Hook(h).run(d, dep); err != nil {
+				Logger.Fatalf("The %s hook of %s failed: %v", event, dep.Name, err)
+			}
+		}
+	}
+}
+
+// hooks is used to get the hooks of the Deployment for the given event
+func (d Deployment) hooks(event string) []latest.Hook {
+	switch event {
+	case preDeploy:
+		return d.Hooks.PreDeploy
+	case postDeploy:
+		return d.Hooks.PostDeploy
+	case preDelete:
+		return d.Hooks.PreDelete
+	case postDelete:
+		return d.Hooks.PostDelete
+	}
+	return nil
+}
+
+// run is used to run the command of the hook, apply its manifest and wait for
+// its Job, in that order
+//
+// The manifest and Job default to the namespace of the hook and manifests are
+// rendered with the metadata of the given Deployment.
+func (h Hook) run(dry bool, dep Deployment) error {
+	if h.Command == "" && len(h.Manifest.Paths) == 0 && h.Job == "" {
+		return fmt.Errorf("one of command, manifest or job is required")
+	}
+	if h.Command != "" {
+		err := NewCmd("sh").
+			WithArgs([]string{"-c", h.Command}).
+			WithDryRun(dry).
+			Build().
+			Stream()
+		if err != nil {
+			return fmt.Errorf("%s: %w", h.Command, err)
+		}
+	}
+	if !dry && (len(h.Manifest.Paths) > 0 || h.Job != "") {
+		checkKubectl()
+	}
+	if len(h.Manifest.Paths) > 0 {
+		m := newKubectlManifests([]latest.KubectlManifest{h.Manifest}).forDeployment(dep)[0]
+		if m.Namespace == "" {
+			m.Namespace = h.Namespace
+		}
+		if m.Namespace == "" {
+			m.Namespace = "default"
+		}
+		m.Paths = m.localPaths(dry)
+		if err := m.execute(nil, dry, m.installArgs(nil)); err != nil {
+			return err
+		}
+	}
+	if h.Job != "" {
+		ns := h.Namespace
+		if ns == "" {
+			ns = h.Manifest.Namespace
+		}
+		if ns == "" {
+			ns = "default"
+		}
+		return h.waitForJob(dry, ns)
+	}
+	return nil
+}
+
+// waitForJob is used to poll the status of the Job of the hook until it
+// completes, returning an error as soon as it fails or once its timeout
+// elapses
+//
+// kubectl wait can only wait for a single condition, which would leave a
+// failed Job to run out the whole timeout.
+func (h Hook) waitForJob(dry bool, namespace string) error {
+	timeout, err := WaitCondition{Timeout: h.Timeout}.timeout()
+	if err != nil {
+		return err
+	}
+	job := "job/" + h.Job
+	cmd := NewCmd("kubectl").
+		WithArgs([]string{"get", job, "--namespace", namespace, "--output", `jsonpath={.status.conditions[?(@.status=="True")].type}`}).
+		WithDryRun(dry).
+		Build()
+	deadline := time.Now().Add(timeout)
+	for {
+		out, err := cmd.Output()
+		if err != nil || dry {
+			return err
+		}
+		for _, c := range strings.Fields(string(out)) {
+			switch c {
+			case "Complete":
+				return nil
+			case "Failed":
+				return fmt.Errorf("%s failed", job)
+			}
+		}
+		if time.Now().Add(probeInterval).After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for %s to complete", timeout, job)
+		}
+		time.Sleep(probeInterval)
+	}
+}
@@ -0,0 +1,47 @@
+package kruise
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHookRun(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	require.NoError(t, err)
+	dep := Deployment{Name: "db"}
+	h := Hook{Command: "./migrate.sh --check", Job: "migrate", Namespace: "db", Timeout: "1m"}
+	out := trimDeployStdoutPrefix(func() {
+		assert.NoError(t, h.run(true, dep))
+	})
+	assert.Equal(t, sh+" -c ./migrate.sh --check\nkubectl get job/migrate --namespace db --output jsonpath={.status.conditions[?(@.status==\"True\")].type}\n", out)
+	assert.Error(t, Hook{}.run(true, dep))
+
+	h = Hook{Command: "echo ran; exit 3"}
+	out = captureStdout(func() {
+		assert.Error(t, h.run(false, dep), "a failing command should fail the hook")
+	})
+	assert.Equal(t, "ran\n", out, "the output of a failing command is still shown")
+	out = captureStdout(func() {
+		assert.NoError(t, Hook{Command: "echo ran"}.run(false, dep))
+	})
+	assert.Equal(t, "ran\n", out)
+	assert.Equal(t, []latest.Hook{latest.Hook(h)}, Deployment{Hooks: latest.DeploymentHooks{PostDelete: []latest.Hook{latest.Hook(h)}}}.hooks(postDelete))
+}
+
+func TestHookJobFailed(t *testing.T) {
+	// a stand-in kubectl whose Job has failed
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "kubectl"), []byte("#!/bin/sh\necho Failed\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	start := time.Now()
+	err := Hook{Job: "migrate", Namespace: "db", Timeout: "1m"}.waitForJob(false, "db")
+	assert.EqualError(t, err, "job/migrate failed")
+	assert.Less(t, time.Since(start), time.Minute, "a failed Job shouldn't wait out its timeout")
+}
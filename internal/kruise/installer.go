@@ -1,8 +1,8 @@
 package kruise
 
 import (
+	"io"
 	"sort"
-	"sync"
 
 	"github.com/spf13/pflag"
 )
@@ -10,35 +10,67 @@ import (
 type (
 	// Installer represents an interface for generic objects that can be
 	// installed and uninstalled
+	//
+	// Everything an Installer prints is written to the given io.Writer, or
+	// stdout if it is nil, and whether it failed is reported with the error
+	// it returns.
 	Installer interface {
-		Install(fs *pflag.FlagSet)
-		Uninstall(fs *pflag.FlagSet)
+		Install(fs *pflag.FlagSet, out io.Writer) error
+		Uninstall(fs *pflag.FlagSet, out io.Writer) error
 		GetPriority() int
 		IsInit() bool
 	}
 	// Installers represents a slice of Installer objects
 	Installers []Installer
+	// preparer represents an Installer that needs input, which may mean
+	// prompting the user, before it can be installed
+	preparer interface {
+		prepare(fs *pflag.FlagSet)
+	}
+	// waiter represents an Installer that has readiness checks to pass before
+	// anything of a later priority is installed
+	waiter interface {
+		wait(fs *pflag.FlagSet, out io.Writer) error
+	}
 )
 
+// Prepare gathers the input needed by all Installers passed, asking the user
+// every question up front so that installing them can run unattended
+func Prepare(fs *pflag.FlagSet, installers ...Installer) {
+	for _, i := range installers {
+		if p, ok := i.(preparer); ok {
+			p.prepare(fs)
+		}
+	}
+}
+
 // Init invokes the Install function for all Installers that should only be
 // installed during initialization (i.e. HelmRepositories and KubectlSecrets)
 func Init(fs *pflag.FlagSet, installers ...Installer) {
-	hasHelmDeployment := false
+	concurrent, err := fs.GetBool("concurrent")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	var pre Installers
+	var post Installers
 	for _, i := range installers {
 		switch d := i.(type) {
-		case HelmChart, KubectlManifest, KubectlDockerRegistrySecret, KubectlGenericSecret:
-			i.Install(fs)
-		case HelmRepository:
-			hasHelmDeployment = true
-			i.Install(fs)
+		case HelmChart, KubectlManifest, KubectlKustomization, Exec:
+			post = append(post, d)
+		case HelmRepository, secretInstaller:
+			pre = append(pre, d)
 		default:
 			Logger.Errorf("Invalid installer for the Init() function: %v", d)
 		}
 	}
-	// if a Helm installer was in the list of the installers to initialize,
-	// perform a helm repo update at the end
-	if hasHelmDeployment {
-		helmRepoUpdate(fs)
+	Prepare(fs, pre...)
+	switch {
+	case concurrent:
+		installc(fs, pre...)
+		installc(fs, post...)
+	default:
+		installs(fs, pre...)
+		installs(fs, post...)
 	}
 }
 
@@ -48,137 +80,146 @@ func Install(fs *pflag.FlagSet, installers ...Installer) {
 	if err != nil {
 		Logger.Fatal(err)
 	}
-	hasHelmDeployment := false
 	var pre Installers
 	var post Installers
 	for _, i := range installers {
 		switch d := i.(type) {
-		case HelmChart, KubectlManifest:
+		case HelmChart, KubectlManifest, KubectlKustomization, Exec:
 			post = append(post, d)
-		case HelmRepository:
-			hasHelmDeployment = true
-			pre = append(pre, d)
-		case KubectlGenericSecret, KubectlDockerRegistrySecret:
+		case HelmRepository, secretInstaller:
 			pre = append(pre, d)
 		default:
 			Logger.Errorf("Invalid installer for the Install() function: %v", d)
 		}
 	}
+	// anything that may prompt the user is prepared up front, so everything can
+	// run concurrently
+	Prepare(fs, pre...)
 	switch {
 	case concurrent:
-		// don't use concurrency for deployments that may prompt the user for input
-		installs(fs, pre...)
+		installc(fs, pre...)
 		installc(fs, post...)
 	default:
-		installs(fs, installers...)
-	}
-	// if a Helm installer was in the list of the installers to initialize,
-	// perform a helm repo update at the end
-	if hasHelmDeployment {
-		helmRepoUpdate(fs)
+		installs(fs, pre...)
+		installs(fs, post...)
 	}
 }
 
 // Uninstall invokes the Uninstall function for all Installers passed
+//
+// Installers are uninstalled in the reverse of the order they're installed in:
+// charts, manifests and other workloads first, by descending priority, then
+// secrets and finally repositories.
 func Uninstall(fs *pflag.FlagSet, installers ...Installer) {
 	concurrent, err := fs.GetBool("concurrent")
 	if err != nil {
 		Logger.Fatal(err)
 	}
+	var workloads Installers
+	var secrets Installers
+	var repos Installers
+	for _, i := range installers {
+		switch d := i.(type) {
+		case HelmChart, KubectlManifest, KubectlKustomization, Exec:
+			workloads = append(workloads, d)
+		case secretInstaller:
+			secrets = append(secrets, d)
+		case HelmRepository:
+			repos = append(repos, d)
+		default:
+			Logger.Errorf("Invalid installer for the Uninstall() function: %v", d)
+		}
+	}
 	switch {
 	case concurrent:
-		uninstallc(fs, installers...)
+		uninstallc(fs, workloads...)
+		uninstallc(fs, secrets...)
+		uninstallc(fs, repos...)
 	default:
-		uninstalls(fs, installers...)
+		uninstalls(fs, byDescendingPriority(reversed(workloads))...)
+		uninstalls(fs, reversed(secrets)...)
+		uninstalls(fs, reversed(repos)...)
 	}
 }
 
 // installs is used to invoke the install functions of the given Installers
 func installs(fs *pflag.FlagSet, installers ...Installer) {
 	for _, i := range installers {
-		install(i, fs)
+		if err := install(i, fs, nil); err != nil {
+			Logger.Error(err)
+		}
 	}
 }
 
 // installc is used to concurrently invoke the install functions of the given
 // Installers
 //
-// Waitgroups are contructed based on Installer Priority where each batch of
-// prioritized deployments are executed concurrently
+// Batches are contructed based on Installer Priority where each batch of
+// prioritized deployments are executed concurrently, starting with the lowest
+// priority
 func installc(fs *pflag.FlagSet, installers ...Installer) {
-	m := priorityMap(installers...)
-	var keys []int
-	for k := range m {
-		keys = append(keys, k)
-	}
-	sort.Ints(keys)
-	for _, k := range keys {
-		wg := sync.WaitGroup{}
-		Logger.Infof("Priority %d waitgroup starting", k)
-		wg.Add(len(m[k]))
-		for _, i := range m[k] {
-			go installp(i, fs, &wg)
-		}
-		wg.Wait()
-		Logger.Debugf("Priority %d waitgroup stopping", k)
-	}
-	Logger.Debug("Finished running concurrently")
+	runc(fs, false, install, installers...)
 }
 
-// installp is used to invoke the install function of a given Installer and
-// call wg.Done()
-func installp(i Installer, fs *pflag.FlagSet, wg *sync.WaitGroup) {
-	defer wg.Done()
-	install(i, fs)
-}
-
-// install is used to invoke the install function of a given Installer
-func install(i Installer, fs *pflag.FlagSet) {
-	i.Install(fs)
+// install is used to invoke the install function of a given Installer and
+// wait for it to be ready, recording the Result on the report if there is one
+func install(i Installer, fs *pflag.FlagSet, out io.Writer) (err error) {
+	done := record(i)
+	defer func() { done(err) }()
+	if err := i.Install(fs, out); err != nil {
+		return err
+	}
+	if w, ok := i.(waiter); ok {
+		return w.wait(fs, out)
+	}
+	return nil
 }
 
 // uninstalls is used to invoke the uninstall functions of the given Installers
 func uninstalls(fs *pflag.FlagSet, installers ...Installer) {
 	for _, i := range installers {
-		i.Uninstall(fs)
+		if err := uninstall(i, fs, nil); err != nil {
+			Logger.Error(err)
+		}
 	}
 }
 
 // uninstallc is used to concurrently invoke the uninstall functions of the
 // given Installers
 //
-// Waitgroups are contructed based on Installer Priority where each batch of
-// prioritized deployments are executed concurrently
+// Batches are contructed based on Installer Priority where each batch of
+// prioritized deployments are executed concurrently, starting with the highest
+// priority
 func uninstallc(fs *pflag.FlagSet, installers ...Installer) {
-	m := priorityMap(installers...)
-	var keys []int
-	for k := range m {
-		keys = append(keys, k)
-	}
-	sort.Ints(keys)
-	for _, k := range keys {
-		wg := sync.WaitGroup{}
-		Logger.Infof("Priority %d waitgroup starting", k)
-		wg.Add(len(m[k]))
-		for _, i := range m[k] {
-			go uninstallp(i, fs, &wg)
-		}
-		wg.Wait()
-		Logger.Debugf("Priority %d waitgroup stopping", k)
-	}
-	Logger.Debug("Finished running concurrently")
+	runc(fs, true, uninstall, installers...)
 }
 
-// uninstallp is used to invoke the uninstall function of a given Installer and
-// call wg.Done()
-func uninstallp(i Installer, fs *pflag.FlagSet, wg *sync.WaitGroup) {
-	defer wg.Done()
-	uninstall(i, fs)
+// uninstall is used to invoke the uninstall function of a given Installer,
+// recording the Result on the report if there is one
+func uninstall(i Installer, fs *pflag.FlagSet, out io.Writer) (err error) {
+	done := record(i)
+	defer func() { done(err) }()
+	return i.Uninstall(fs, out)
+}
+
+// reversed is used to get a copy of the given Installers in reverse order
+func reversed(installers Installers) Installers {
+	r := make(Installers, 0, len(installers))
+	for i := len(installers) - 1; i >= 0; i-- {
+		r = append(r, installers[i])
+	}
+	return r
 }
 
-// uninstall is used to invoke the uninstall function of a given Installer
-func uninstall(i Installer, fs *pflag.FlagSet) {
-	i.Uninstall(fs)
+// byDescendingPriority is used to get a copy of the given Installers sorted
+// from the highest priority to the lowest, keeping the order of Installers
+// with the same priority
+func byDescendingPriority(installers Installers) Installers {
+	s := append(Installers{}, installers...)
+	sort.SliceStable(s, func(i, j int) bool {
+		return s[i].GetPriority() > s[j].GetPriority()
+	})
+	return s
 }
 
 // priorityMap is used to construct a map of prioritized Installers
@@ -0,0 +1,30 @@
+package kruise
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUninstallOrder(t *testing.T) {
+	InitializeLogger()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", true, "")
+	fs.Bool("concurrent", false, "")
+	var buf bytes.Buffer
+	output = &buf
+	t.Cleanup(func() { output = nil })
+	exe := func(name string, priority int) Exec {
+		return newExec(latest.Exec{Name: name, UninstallCommand: "echo " + name, Priority: priority})
+	}
+	Uninstall(fs, exe("istio", 1), exe("jaeger", 3), exe("kiali", 2), exe("prometheus", 3))
+	var order []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		order = append(order, line[strings.LastIndex(line, " ")+1:])
+	}
+	assert.Equal(t, []string{"prometheus", "jaeger", "kiali", "istio"}, order)
+}
@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -23,6 +24,8 @@ type Konfig struct {
 	Name        string
 	Override    string
 	Manifest    latest.KruiseConfig
+	Lock        *Lockfile
+	BundleDir   string
 }
 
 // NewKonfig is used to create a new Kruise config (Konfig) object
@@ -59,6 +62,12 @@ func NewKonfig() *Konfig {
 	// it with an environment variable
 	// The CLI is driven by config so we can't override the config from the CLI
 	cfg.Override = os.Getenv("KRUISE_CONFIG")
+	// A bundle created by kruise bundle carries its own config, which takes
+	// precedence over any other config
+	if b := bundleFromArgs(os.Args[1:]); b != "" {
+		cfg.BundleDir = openBundle(b)
+		cfg.Override = filepath.Join(cfg.BundleDir, bundleConfigName)
+	}
 	cfg.ApplyUserConfig()
 	return cfg
 }
@@ -68,13 +77,31 @@ func NewKonfig() *Konfig {
 func (k *Konfig) ApplyUserConfig() {
 	Logger.Debug("Setting config")
 	k.setConfig()
+	cfgFile := viper.ConfigFileUsed()
+	if k.Override != "" {
+		cfgFile = k.Override
+	}
+	if viper.IsSet("sops") {
+		decryptConfig(cfgFile)
+	}
 	Logger.Debug("Unmarshalling config")
 	k.unmarshalConfig()
-	if k.Override != "" {
-		Logger.Infof("Using config file: %s", k.Override)
-		return
+	k.resolveBundlePaths()
+	Logger.Infof("Using config file: %s", cfgFile)
+	k.applyLockfile(cfgFile)
+}
+
+// applyLockfile reads in the lockfile that lives alongside the given config
+// file
+func (k *Konfig) applyLockfile(cfgFile string) {
+	lock, err := loadLockfile(lockfilePath(cfgFile))
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if len(lock.Charts) > 0 {
+		Logger.Debugf("Using lockfile: %s", lock.Path)
 	}
-	Logger.Infof("Using config file: %s", viper.ConfigFileUsed())
+	k.Lock = lock
 }
 
 // setConfig is used to set the kruise config file
@@ -108,7 +135,7 @@ func checkConfig(k Konfig) {
 // location or URL
 func overrideConfig(config string) {
 	Logger.Debugf("Attempting to use config defined by KRUISE_CONFIG: %s", config)
-	if strings.HasPrefix(config, "http") {
+	if isURL(config) {
 		// if config is set from a URL currently only yaml is supported; not sure if
 		// there is a way around this
 		// in order to read config from a URL, you must set the config type before
@@ -5,15 +5,35 @@ package kruise
 
 import (
 	"os"
+	"sync"
 
 	"github.com/charmbracelet/log"
 )
 
+type (
+	// Klogger is the logger used by Kruise
+	//
+	// Logging a fatal error cleans up everything registered with atExit
+	// before exiting, since deferred functions don't run on os.Exit.
+	Klogger struct {
+		*log.Logger
+	}
+
+	// cleanup represents a function registered with atExit
+	cleanup struct {
+		once sync.Once
+		fn   func()
+	}
+)
+
 var (
 	// Kfg is a global config object for Kruise into which config is unmarshalled
 	Kfg *Konfig
 	// Logger is the global logger used by Kruise
-	Logger *log.Logger
+	Logger *Klogger
+	// cleanups are the functions registered with atExit that haven't run yet
+	cleanups   []*cleanup
+	cleanupsMu sync.Mutex
 )
 
 // Initialize is used to initialize Kruise
@@ -31,7 +51,69 @@ func InitializeConfig() {
 
 // InitializeLogger is used to initialize the Kruise logger
 func InitializeLogger() {
-	Logger = log.New(os.Stderr)
+	// every log line is passed through the redactor so that sensitive values
+	// never end up in logs
+	Logger = &Klogger{log.New(redactWriter{os.Stderr})}
 	// Logger.SetReportCaller(true)
 	Logger.SetLevel(log.WarnLevel)
 }
+
+// Fatal logs a fatal message and exits once everything registered with atExit
+// has been cleaned up
+func (l *Klogger) Fatal(msg interface{}, keyvals ...interface{}) {
+	l.Helper()
+	Cleanup()
+	l.Logger.Fatal(msg, keyvals...)
+}
+
+// Fatalf logs a fatal message with formatting and exits once everything
+// registered with atExit has been cleaned up
+func (l *Klogger) Fatalf(format string, args ...interface{}) {
+	l.Helper()
+	Cleanup()
+	l.Logger.Fatalf(format, args...)
+}
+
+// atExit is used to register a function that cleans up after Kruise, such as
+// removing temporary files, so that it runs however Kruise exits
+//
+// The returned function runs the cleanup straight away instead, and is meant
+// to be deferred. Each cleanup only ever runs once.
+func atExit(fn func()) func() {
+	c := &cleanup{fn: fn}
+	cleanupsMu.Lock()
+	cleanups = append(cleanups, c)
+	cleanupsMu.Unlock()
+	return func() {
+		c.once.Do(c.fn)
+		cleanupsMu.Lock()
+		defer cleanupsMu.Unlock()
+		for n, r := range cleanups {
+			if r == c {
+				cleanups = append(cleanups[:n], cleanups[n+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// exit is used to exit with the given status code once everything registered
+// with atExit has been cleaned up
+func exit(code int) {
+	Cleanup()
+	os.Exit(code)
+}
+
+// Cleanup runs everything registered with atExit that hasn't run yet, most
+// recently registered first
+//
+// It is called before Kruise exits, whether it finishes or not.
+func Cleanup() {
+	cleanupsMu.Lock()
+	pending := cleanups
+	cleanups = nil
+	cleanupsMu.Unlock()
+	for n := len(pending) - 1; n >= 0; n-- {
+		pending[n].once.Do(pending[n].fn)
+	}
+}
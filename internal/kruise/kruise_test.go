@@ -1,11 +1,14 @@
 package kruise
 
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -13,6 +16,7 @@ type ObservabilityIntTestSuite struct {
 	suite.Suite
 	kfg *Konfig
 	fs  *pflag.FlagSet
+	wd  string
 }
 
 func TestObservabilityIntTestSuite(t *testing.T) {
@@ -21,13 +25,33 @@ func TestObservabilityIntTestSuite(t *testing.T) {
 
 func (s *ObservabilityIntTestSuite) SetupSuite() {
 	s.T().Log("Setting Up Observability Integration Test Suite")
-	os.Setenv("KRUISE_CONFIG", "../../examples/observability/kruise.yaml")
+	// templated manifests are read relative to the example, like a user would
+	// run kruise from it
+	wd, err := os.Getwd()
+	s.Require().NoError(err)
+	s.wd = wd
+	s.Require().NoError(os.Chdir("../../examples/observability"))
+	os.Setenv("KRUISE_CONFIG", "kruise.yaml")
+	// the virtual services take their hosts from the environment, which is
+	// pinned so that the expected output doesn't depend on the machine
+	s.T().Setenv("JAEGER_HOST", "")
+	s.T().Setenv("GRAFANA_HOST", "")
 	Initialize()
 	s.kfg = Kfg
 	s.fs = pflag.NewFlagSet("test", pflag.ContinueOnError)
 	s.fs.BoolP("concurrent", "c", false, "")
 	s.fs.BoolP("init", "i", false, "")
 	s.fs.BoolP("dry-run", "d", true, "")
+	s.fs.Bool("non-interactive", false, "")
+	s.fs.Bool("force-recreate", false, "")
+	s.fs.Bool("keep-secrets", false, "")
+	s.fs.Bool("keep-repos", false, "")
+	s.fs.Int("max-parallel", 0, "")
+	s.fs.StringSlice("report", nil, "")
+}
+
+func (s *ObservabilityIntTestSuite) TearDownSuite() {
+	s.Require().NoError(os.Chdir(s.wd))
 }
 
 func (s *ObservabilityIntTestSuite) TestIstioDeployment() {
@@ -35,6 +59,104 @@ func (s *ObservabilityIntTestSuite) TestIstioDeployment() {
 	s.Equal(s.expectedIstio(), actual)
 }
 
+func (s *ObservabilityIntTestSuite) TestIstioDelete() {
+	actual := trimDeployStdoutPrefix(func() { Delete(s.fs, []string{"istio"}) })
+	expected := `
+kubectl delete --namespace istio-system -f manifests/istio-gateway.yaml
+helm uninstall istio-ingressgateway --namespace istio-system
+helm uninstall istiod --namespace istio-system
+helm uninstall istio-base --namespace istio-system
+`
+	s.Equal(strings.TrimPrefix(expected, "\n"), actual)
+}
+
+func (s *ObservabilityIntTestSuite) TestIstioDeployReport() {
+	path := filepath.Join(s.T().TempDir(), "result.json")
+	s.Require().NoError(s.fs.Set("report", path))
+	defer s.fs.Lookup("report").Value.(pflag.SliceValue).Replace(nil)
+	trimDeployStdoutPrefix(s.deployIstio)
+	b, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	var rf resultFile
+	s.Require().NoError(json.Unmarshal(b, &rf))
+	s.Equal("deploy", rf.Command)
+	s.True(rf.DryRun)
+	s.Equal(4, rf.Succeeded)
+	s.Zero(rf.Failed)
+	var names []string
+	for _, r := range rf.Results {
+		s.Equal("istio", r.Deployment)
+		names = append(names, r.Type+" "+r.Name)
+	}
+	s.Equal([]string{
+		"chart istio-base",
+		"chart istiod",
+		"chart istio-ingressgateway",
+		"manifest manifests/istio-gateway.yaml",
+	}, names)
+}
+
+func (s *ObservabilityIntTestSuite) TestList() {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.StringP("output", "o", "table", "")
+	fs.StringP("namespace", "n", "tracing", "")
+	fs.String("type", "", "")
+	actual := captureStdout(func() { List(fs, nil) })
+	expected := `
+DEPLOYMENT   DESCRIPTION
+jaeger       deploy Jaeger to your k8s cluster
+
+PROFILE         DESCRIPTION
+observability   deploy an observability stack to the cluster
+`
+	s.Equal(strings.TrimPrefix(expected, "\n"), actual)
+
+	s.Require().NoError(fs.Set("output", "json"))
+	s.Require().NoError(fs.Set("namespace", ""))
+	s.Require().NoError(fs.Set("type", "manifest"))
+	var deps []deploymentListing
+	s.Require().NoError(json.Unmarshal([]byte(captureStdout(func() { List(fs, []string{"deployments"}) })), &deps))
+	var names []string
+	for _, d := range deps {
+		names = append(names, d.Name)
+		s.Len(d.Installers, 1)
+	}
+	s.Equal([]string{"istio", "jaeger", "prometheus-operator"}, names)
+	s.Equal([]string{"observability", "metrics"}, deps[2].Profiles)
+}
+
+func (s *ObservabilityIntTestSuite) TestDescribe() {
+	actual := captureStdout(func() { Describe(s.fs, []string{"logging", "jaeger"}) })
+	expected := `
+Deployments: istio, loki, jaeger
+  logging (profile): istio, loki
+  jaeger
+
+Init installers (only with --init):
+  STEP   PRIORITY   TYPE         NAME            NAMESPACE   DEPLOYMENT
+  1      0          repository   istio           -           istio
+  2      0          repository   grafana         -           loki
+  3      0          repository   jaegertracing   -           jaeger
+  With --concurrent, each batch runs at once:
+    priority 0: repository istio, repository grafana, repository jaegertracing
+
+Installers:
+  STEP   PRIORITY   TYPE       NAME                                    NAMESPACE      DEPLOYMENT
+  4      1          chart      istio-base                              istio-system   istio
+  5      1          chart      istiod                                  istio-system   istio
+  6      2          chart      istio-ingressgateway                    istio-system   istio
+  7      2          manifest   manifests/istio-gateway.yaml            istio-system   istio
+  8      3          chart      loki                                    logging        loki
+  9      3          chart      jaeger                                  tracing        jaeger
+  10     3          manifest   manifests/jaeger-virtual-service.yaml   tracing        jaeger
+  With --concurrent, each batch runs at once:
+    priority 1: chart istio-base, chart istiod
+    priority 2: chart istio-ingressgateway, manifest manifests/istio-gateway.yaml
+    priority 3: chart loki, chart jaeger, manifest manifests/jaeger-virtual-service.yaml
+`
+	s.Equal(strings.TrimPrefix(expected, "\n"), actual)
+}
+
 func (s *ObservabilityIntTestSuite) TestJaegerDeployment() {
 	actual := trimDeployStdoutPrefix(s.deployJaeger)
 	s.Equal(s.expectedJaeger(), actual)
@@ -84,7 +206,9 @@ func (s *ObservabilityIntTestSuite) deployTelemetry() {
 func (s *ObservabilityIntTestSuite) expectedIstio() string {
 	expected := `
 helm upgrade --install istio-base istio/base --namespace istio-system --version 1.14.1 -f values/istio-base-values.yaml --create-namespace
+kubectl wait crd/gateways.networking.istio.io --for condition=Established --timeout 2m0s
 helm upgrade --install istiod istio/istiod --namespace istio-system --version 1.14.1 -f values/istiod-values.yaml --create-namespace
+kubectl rollout status deployment/istiod --namespace istio-system --timeout 5m0s
 helm upgrade --install istio-ingressgateway istio/gateway --namespace istio-system --version 1.14.1 -f values/istio-gateway-values.yaml --set service.externalIPs[0]=CHANGE_ME --create-namespace
 kubectl create namespace istio-system
 kubectl apply --namespace istio-system -f manifests/istio-gateway.yaml
@@ -97,7 +221,31 @@ func (s *ObservabilityIntTestSuite) expectedJaeger() string {
 	expected := `
 helm upgrade --install jaeger jaegertracing/jaeger --namespace tracing --version 0.57.1 -f values/jaeger-values.yaml --create-namespace
 kubectl create namespace tracing
-kubectl apply --namespace tracing -f manifests/jaeger-virtual-service.yaml
+kubectl apply --namespace tracing -f - <<EOF
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: jaeger
+spec:
+  gateways:
+    - istio-system/istio-ingressgateway
+  hosts:
+    - "*"
+  http:
+    - match:
+        - uri:
+            prefix: "/tracing"
+      route:
+        - destination:
+            host: jaeger-query
+            port:
+              number: 16686
+    - match:
+        - uri:
+            prefix: "/jaeger"
+      redirect:
+        uri: "/tracing"
+EOF
 `
 	expected = strings.TrimPrefix(expected, "\n")
 	return expected
@@ -115,7 +263,38 @@ func (s *ObservabilityIntTestSuite) expectedPrometheusOperator() string {
 	expected := `
 helm upgrade --install prometheus-operator prometheus-community/kube-prometheus-stack --namespace monitoring --version 36.0.2 -f values/prometheus-operator-values.yaml --create-namespace
 kubectl create namespace monitoring
-kubectl apply --namespace monitoring -f manifests/grafana-virtual-service.yaml
+kubectl apply --namespace monitoring -f - <<EOF
+apiVersion: networking.istio.io/v1alpha3
+kind: VirtualService
+metadata:
+  name: grafana
+spec:
+  gateways:
+    - istio-system/istio-ingressgateway
+  hosts:
+    - "*"
+  http:
+    - match:
+        - uri:
+            prefix: "/monitoring"
+      route:
+        - destination:
+            host: prometheus-operator-grafana
+      headers:
+        request:
+          remove:
+            - authorization
+    - match:
+        - uri:
+            prefix: "/metrics"
+      redirect:
+        uri: "/monitoring"
+    - match:
+        - uri:
+            prefix: "/grafana"
+      redirect:
+        uri: "/monitoring"
+EOF
 `
 	expected = strings.TrimPrefix(expected, "\n")
 	return expected
@@ -126,3 +305,15 @@ func (s *ObservabilityIntTestSuite) expectedObservability() string {
 	expected = strings.TrimPrefix(expected, "\n")
 	return expected
 }
+
+func TestAtExit(t *testing.T) {
+	var ran []string
+	atExit(func() { ran = append(ran, "first") })
+	done := atExit(func() { ran = append(ran, "second") })
+	atExit(func() { ran = append(ran, "third") })
+	done()
+	done()
+	Cleanup()
+	Cleanup()
+	assert.Equal(t, []string{"second", "third", "first"}, ran)
+}
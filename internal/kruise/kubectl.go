@@ -4,34 +4,86 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"fmt"
+	"hash"
+	"io"
 	"os/exec"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/j2udev/kruise/internal/schema/latest"
 	"github.com/spf13/pflag"
 )
 
 type (
-	// KubectlDeployment encapsulates Helm objects like KubectlGenericSecrets,
+	// KubectlDeployment encapsulates Kubectl objects like KubectlGenericSecrets,
 	// KubectlDockerRegistrySecrets and KubectlManifests for a given deployment
 	KubectlDeployment latest.KubectlDeployment
 	// KubectlManifest represents information about a Kubectl manifest
-	KubectlManifest latest.KubectlManifest
+	// The Deployment and Releases fields are used to render templated
+	// manifests with the metadata of the deployment they belong to.
+	KubectlManifest struct {
+		latest.KubectlManifest
+		Deployment string
+		Releases   map[string]string
+	}
 	// KubectlGenericSecret represents information about a generic Kubernetes
 	// secret
-	// The Namespaces field is used to support creating the same secret across
-	// multiple namespaces and only prompting the user once.
 	KubectlGenericSecret struct {
 		latest.KubectlGenericSecret
-		Namespaces []string
+		kubectlSecret
 	}
 	// KubectlDockerRegistrySecret represents information about a docker-registry
 	// Kubernetes secret
-	// The Namespaces field is used to support creating the same secret across
-	// multiple namespaces and only prompting the user once.
 	KubectlDockerRegistrySecret struct {
 		latest.KubectlDockerRegistrySecret
+		kubectlSecret
+	}
+	// KubectlTLSSecret represents information about a tls Kubernetes secret
+	KubectlTLSSecret struct {
+		latest.KubectlTLSSecret
+		kubectlSecret
+	}
+	// KubectlBasicAuthSecret represents information about a basic-auth Kubernetes secret
+	KubectlBasicAuthSecret struct {
+		latest.KubectlBasicAuthSecret
+		kubectlSecret
+	}
+	// KubectlSSHAuthSecret represents information about a ssh-auth Kubernetes secret
+	KubectlSSHAuthSecret struct {
+		latest.KubectlSSHAuthSecret
+		kubectlSecret
+	}
+	// KubectlServiceAccountTokenSecret represents information about a service-account-token Kubernetes secret
+	KubectlServiceAccountTokenSecret struct {
+		latest.KubectlServiceAccountTokenSecret
+		kubectlSecret
+	}
+	// kubectlSecret is embedded in every kind of Kubernetes secret
+	//
+	// The Namespaces field is used to support creating the same secret across
+	// multiple namespaces and only prompting the user once. The policy field
+	// holds the onExists policy of the secret with its default resolved.
+	kubectlSecret struct {
 		Namespaces []string
+		policy     string
+	}
+	// secretInstaller is implemented by every kind of Kubernetes secret
+	secretInstaller interface {
+		Installer
+		namespaces() []string
+	}
+	// preparedSecret represents the namespaces that a secret will be applied
+	// to and the Kubernetes Secret objects built for them
+	preparedSecret struct {
+		namespaces []string
+		secrets    []kubernetesSecret
+	}
+	// preparedSecretEntry represents a secret that is being or has been
+	// prepared, so that concurrent installers wait for a single preparation
+	preparedSecretEntry struct {
+		once     sync.Once
+		prepared preparedSecret
 	}
 	// KubectlDeployments represents a slice of KubectlDeployment objects
 	KubectlDeployments []KubectlDeployment
@@ -42,10 +94,24 @@ type (
 	// KubectlDockerRegistrySecrets represents a slice of
 	// KubectlDockerRegistrySecret objects
 	KubectlDockerRegistrySecrets []KubectlDockerRegistrySecret
+	// KubectlTLSSecrets represents a slice of KubectlTLSSecret objects
+	KubectlTLSSecrets []KubectlTLSSecret
+	// KubectlBasicAuthSecrets represents a slice of KubectlBasicAuthSecret objects
+	KubectlBasicAuthSecrets []KubectlBasicAuthSecret
+	// KubectlSSHAuthSecrets represents a slice of KubectlSSHAuthSecret objects
+	KubectlSSHAuthSecrets []KubectlSSHAuthSecret
+	// KubectlServiceAccountTokenSecrets represents a slice of KubectlServiceAccountTokenSecret objects
+	KubectlServiceAccountTokenSecrets []KubectlServiceAccountTokenSecret
 )
 
+// preparedSecrets keeps track of the secrets prepared during a run
+var preparedSecrets = struct {
+	mu sync.Mutex
+	m  map[string]*preparedSecretEntry
+}{m: make(map[string]*preparedSecretEntry)}
+
 // Install is used to execute a Kubectl apply command
-func (m KubectlManifest) Install(fs *pflag.FlagSet) {
+func (m KubectlManifest) Install(fs *pflag.FlagSet, out io.Writer) error {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
@@ -53,88 +119,82 @@ func (m KubectlManifest) Install(fs *pflag.FlagSet) {
 	if !d {
 		checkKubectl()
 	}
-	err = kubectlCreateNamespace(d, m.Namespace)
+	err = kubectlCreateNamespace(out, d, m.Namespace)
 	if err != nil {
 		Logger.Debug(err)
 	}
-	err = kubectlExecute(d, m.installArgs(fs))
-	if err != nil {
-		Logger.Error(err)
-	}
+	m.Paths = m.localPaths(d)
+	return m.execute(out, d, m.installArgs(fs))
 }
 
-// Install is used to execute a Kubectl create generic secret command
-func (s KubectlGenericSecret) Install(fs *pflag.FlagSet) {
-	d, err := fs.GetBool("dry-run")
-	if err != nil {
-		Logger.Fatal(err)
-	}
-	if !d {
-		checkKubectl()
-	}
-	for _, ns := range s.Namespaces {
-		err = kubectlCreateNamespace(d, ns)
-		if err != nil {
-			Logger.Debug(err)
-		}
-	}
-	// for now, just overwrite any existing secret
-	s.Uninstall(fs)
-	switch len(s.Namespaces) {
-	case 0:
-		fmt.Printf("Creating generic secret %s in the default namespace\n", s.Name)
-	case 1:
-		fmt.Printf("Creating generic secret %s in the %s namespace\n", s.Name, s.Namespace)
-	default:
-		fmt.Printf("Creating generic secret %s in the %s namespaces\n", s.Name, s.Namespaces)
-	}
-	args := s.installArgs(fs)
-	for _, a := range args {
-		Logger.Debugf("%s %s", "kubectl", strings.Join(a, " "))
-		err = kubectlExecute(d, a)
-		if err != nil {
-			Logger.Error(err)
-		}
-	}
+// Install is used to create a generic Kubernetes secret
+func (s KubectlGenericSecret) Install(fs *pflag.FlagSet, out io.Writer) error {
+	return installSecrets(fs, out, "generic", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
 }
 
-// Install is used to execute a Kubectl create docker-registry secret command
-func (s KubectlDockerRegistrySecret) Install(fs *pflag.FlagSet) {
-	d, err := fs.GetBool("dry-run")
-	if err != nil {
-		Logger.Fatal(err)
-	}
-	if !d {
-		checkKubectl()
-	}
-	for _, ns := range s.Namespaces {
-		err = kubectlCreateNamespace(d, ns)
-		if err != nil {
-			Logger.Debug(err)
-		}
-	}
-	// for now, just overwrite any existing secret
-	s.Uninstall(fs)
-	switch len(s.Namespaces) {
-	case 0:
-		fmt.Printf("Creating docker-registry secret %s in the default namespace\n", s.Name)
-	case 1:
-		fmt.Printf("Creating docker-registry secret %s in the %s namespace\n", s.Name, s.Namespace)
-	default:
-		fmt.Printf("Creating docker-registry secret %s in the %s namespaces\n", s.Name, s.Namespaces)
-	}
-	args := s.installArgs(fs)
-	for _, a := range args {
-		Logger.Debugf("%s %s", "kubectl", strings.Join(a, " "))
-		err = kubectlExecute(d, a)
-		if err != nil {
-			Logger.Error(err)
-		}
-	}
+// Install is used to create a docker-registry Kubernetes secret
+func (s KubectlDockerRegistrySecret) Install(fs *pflag.FlagSet, out io.Writer) error {
+	return installSecrets(fs, out, "docker-registry", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// Install is used to create a tls Kubernetes secret
+func (s KubectlTLSSecret) Install(fs *pflag.FlagSet, out io.Writer) error {
+	return installSecrets(fs, out, "tls", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// Install is used to create a basic-auth Kubernetes secret
+func (s KubectlBasicAuthSecret) Install(fs *pflag.FlagSet, out io.Writer) error {
+	return installSecrets(fs, out, "basic-auth", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// Install is used to create an ssh-auth Kubernetes secret
+func (s KubectlSSHAuthSecret) Install(fs *pflag.FlagSet, out io.Writer) error {
+	return installSecrets(fs, out, "ssh-auth", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// Install is used to create a service-account-token Kubernetes secret
+func (s KubectlServiceAccountTokenSecret) Install(fs *pflag.FlagSet, out io.Writer) error {
+	return installSecrets(fs, out, "service-account-token", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// prepare is used to gather the input needed by a generic Kubernetes secret
+// before anything is installed
+func (s KubectlGenericSecret) prepare(fs *pflag.FlagSet) {
+	prepareSecrets(fs, "generic", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// prepare is used to gather the input needed by a docker-registry Kubernetes secret
+// before anything is installed
+func (s KubectlDockerRegistrySecret) prepare(fs *pflag.FlagSet) {
+	prepareSecrets(fs, "docker-registry", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// prepare is used to gather the input needed by a tls Kubernetes secret
+// before anything is installed
+func (s KubectlTLSSecret) prepare(fs *pflag.FlagSet) {
+	prepareSecrets(fs, "tls", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// prepare is used to gather the input needed by a basic-auth Kubernetes secret
+// before anything is installed
+func (s KubectlBasicAuthSecret) prepare(fs *pflag.FlagSet) {
+	prepareSecrets(fs, "basic-auth", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// prepare is used to gather the input needed by an ssh-auth Kubernetes secret
+// before anything is installed
+func (s KubectlSSHAuthSecret) prepare(fs *pflag.FlagSet) {
+	prepareSecrets(fs, "ssh-auth", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
+}
+
+// prepare is used to gather the input needed by a service-account-token Kubernetes secret
+// before anything is installed
+func (s KubectlServiceAccountTokenSecret) prepare(fs *pflag.FlagSet) {
+	prepareSecrets(fs, "service-account-token", s.Name, s.hash(), s.policy, s.Namespaces, s.secrets)
 }
 
 // Uninstall is used to execute a Kubectl delete command
-func (m KubectlManifest) Uninstall(fs *pflag.FlagSet) {
+func (m KubectlManifest) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
@@ -142,48 +202,48 @@ func (m KubectlManifest) Uninstall(fs *pflag.FlagSet) {
 	if !d {
 		checkKubectl()
 	}
-	err = kubectlExecute(d, m.uninstallArgs(fs))
+	m.Paths = m.localPaths(d)
+	err = m.execute(out, d, m.uninstallArgs(fs))
 	if err != nil {
 		Logger.Warn(err)
 	}
+	return nil
 }
 
 // Uninstall is used to execute a Kubectl delete secret command
-func (s KubectlGenericSecret) Uninstall(fs *pflag.FlagSet) {
-	d, err := fs.GetBool("dry-run")
-	if err != nil {
-		Logger.Fatal(err)
-	}
-	if !d {
-		checkKubectl()
-	}
-	args := s.uninstallArgs(fs)
-	for _, a := range args {
-		Logger.Debugf("%s %s", "kubectl", strings.Join(a, " "))
-		err = kubectlDeleteSecret(d, a)
-		if err != nil {
-			Logger.Debug(err)
-		}
-	}
+func (s KubectlGenericSecret) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	uninstallSecrets(fs, out, s.Name, s.Namespaces)
+	return nil
 }
 
 // Uninstall is used to execute a Kubectl delete secret command
-func (s KubectlDockerRegistrySecret) Uninstall(fs *pflag.FlagSet) {
-	d, err := fs.GetBool("dry-run")
-	if err != nil {
-		Logger.Fatal(err)
-	}
-	if !d {
-		checkKubectl()
-	}
-	args := s.uninstallArgs(fs)
-	for _, a := range args {
-		Logger.Debugf("%s %s", "kubectl", strings.Join(a, " "))
-		err = kubectlDeleteSecret(d, a)
-		if err != nil {
-			Logger.Debug(err)
-		}
-	}
+func (s KubectlDockerRegistrySecret) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	uninstallSecrets(fs, out, s.Name, s.Namespaces)
+	return nil
+}
+
+// Uninstall is used to execute a Kubectl delete secret command
+func (s KubectlTLSSecret) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	uninstallSecrets(fs, out, s.Name, s.Namespaces)
+	return nil
+}
+
+// Uninstall is used to execute a Kubectl delete secret command
+func (s KubectlBasicAuthSecret) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	uninstallSecrets(fs, out, s.Name, s.Namespaces)
+	return nil
+}
+
+// Uninstall is used to execute a Kubectl delete secret command
+func (s KubectlSSHAuthSecret) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	uninstallSecrets(fs, out, s.Name, s.Namespaces)
+	return nil
+}
+
+// Uninstall is used to execute a Kubectl delete secret command
+func (s KubectlServiceAccountTokenSecret) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	uninstallSecrets(fs, out, s.Name, s.Namespaces)
+	return nil
 }
 
 // GetPriority is used to get the priority of the installer
@@ -192,15 +252,24 @@ func (m KubectlManifest) GetPriority() int {
 }
 
 // GetPriority is used to get the priority of the installer
-func (s KubectlGenericSecret) GetPriority() int {
+func (s kubectlSecret) GetPriority() int {
 	// for now, kubectl secrets are just installed first
 	return 0
 }
 
-// GetPriority is used to get the priority of the installer
-func (s KubectlDockerRegistrySecret) GetPriority() int {
-	// for now, kubectl secrets are just installed first
-	return 0
+// namespaces is used to get the namespaces that the secret is created in
+func (s kubectlSecret) namespaces() []string {
+	return s.Namespaces
+}
+
+// addNamespaces is used to add the given namespaces that the secret isn't
+// created in yet
+func (s *kubectlSecret) addNamespaces(namespaces []string) {
+	for _, ns := range namespaces {
+		if !contains(s.Namespaces, ns) {
+			s.Namespaces = append(s.Namespaces, ns)
+		}
+	}
 }
 
 // IsInit is used to determine whether the installer should be installed during
@@ -221,6 +290,30 @@ func (m KubectlDockerRegistrySecret) IsInit() bool {
 	return m.Init
 }
 
+// IsInit is used to determine whether the installer should be installed during
+// initialization
+func (m KubectlTLSSecret) IsInit() bool {
+	return m.Init
+}
+
+// IsInit is used to determine whether the installer should be installed during
+// initialization
+func (m KubectlBasicAuthSecret) IsInit() bool {
+	return m.Init
+}
+
+// IsInit is used to determine whether the installer should be installed during
+// initialization
+func (m KubectlSSHAuthSecret) IsInit() bool {
+	return m.Init
+}
+
+// IsInit is used to determine whether the installer should be installed during
+// initialization
+func (m KubectlServiceAccountTokenSecret) IsInit() bool {
+	return m.Init
+}
+
 // newKubectlDeployment is a helper function for dealing with the
 // latest.KubectlDeployment to KubectlDeployment type definition
 func newKubectlDeployment(dep latest.KubectlDeployment) KubectlDeployment {
@@ -230,28 +323,103 @@ func newKubectlDeployment(dep latest.KubectlDeployment) KubectlDeployment {
 // newKubectlManifest is a helper function for dealing with the
 // latest.KubectlManifest to KubectlManifest type definition
 func newKubectlManifest(man latest.KubectlManifest) KubectlManifest {
-	return KubectlManifest(man)
+	return KubectlManifest{KubectlManifest: man}
+}
+
+// newKubectlSecret is used to create the kubectlSecret embedded in every kind
+// of Kubernetes secret
+//
+// Secrets that already exist are kept by default if keep is true, which is
+// the case for secrets whose content is prompted for or generated, and updated
+// in place otherwise. An invalid onExists policy is fatal.
+func newKubectlSecret(name string, namespace string, onExists string, keep bool) kubectlSecret {
+	s := kubectlSecret{Namespaces: []string{namespace}, policy: onExists}
+	switch onExists {
+	case "":
+		s.policy = "update"
+		if keep {
+			s.policy = "skip"
+		}
+	case "update", "skip", "prompt", "overwrite":
+	default:
+		Logger.Fatalf("Invalid onExists policy %q for secret %s, expected update, skip, prompt or overwrite", onExists, name)
+	}
+	return s
+}
+
+// genericSecretKept is used to determine whether an existing generic secret
+// is kept by default, which is the case if any of its literals is prompted for
+func genericSecretKept(sec latest.KubectlGenericSecret) bool {
+	for _, l := range sec.Literal {
+		if l.Val == "" && l.Ref == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// credentialsConfigured is used to determine whether both a username and
+// password are configured to be read from somewhere other than a prompt
+func credentialsConfigured(creds latest.Credentials) bool {
+	if creds.DockerConfig != "" || creds.HelmRegistryConfig != "" {
+		return true
+	}
+	return creds.Username != (latest.SecretSource{}) && creds.Password != (latest.SecretSource{})
 }
 
 // newKubectlGenericSecret is a helper function for dealing with the
 // latest.KubectlGenericSecret to KubectlGenericSecret type definition
 func newKubectlGenericSecret(sec latest.KubectlGenericSecret) KubectlGenericSecret {
-	// return KubectlGenericSecret(sec)
 	if sec.Namespace == "" {
 		sec.Namespace = "default"
 	}
-	return KubectlGenericSecret{sec, []string{sec.Namespace}}
+	return KubectlGenericSecret{sec, newKubectlSecret(sec.Name, sec.Namespace, sec.OnExists, genericSecretKept(sec))}
 }
 
 // newKubectlDockerRegistrySecret is a helper function for dealing with the
 // latest.KubectlDockerRegistrySecret to KubectlDockerRegistrySecret type
 // definition
 func newKubectlDockerRegistrySecret(sec latest.KubectlDockerRegistrySecret) KubectlDockerRegistrySecret {
-	// return KubectlDockerRegistrySecret(sec)
 	if sec.Namespace == "" {
 		sec.Namespace = "default"
 	}
-	return KubectlDockerRegistrySecret{sec, []string{sec.Namespace}}
+	return KubectlDockerRegistrySecret{sec, newKubectlSecret(sec.Name, sec.Namespace, sec.OnExists, !credentialsConfigured(sec.Credentials))}
+}
+
+// newKubectlTLSSecret is a helper function for dealing with the
+// latest.KubectlTLSSecret to KubectlTLSSecret type definition
+func newKubectlTLSSecret(sec latest.KubectlTLSSecret) KubectlTLSSecret {
+	if sec.Namespace == "" {
+		sec.Namespace = "default"
+	}
+	return KubectlTLSSecret{sec, newKubectlSecret(sec.Name, sec.Namespace, sec.OnExists, sec.Cert == "")}
+}
+
+// newKubectlBasicAuthSecret is a helper function for dealing with the
+// latest.KubectlBasicAuthSecret to KubectlBasicAuthSecret type definition
+func newKubectlBasicAuthSecret(sec latest.KubectlBasicAuthSecret) KubectlBasicAuthSecret {
+	if sec.Namespace == "" {
+		sec.Namespace = "default"
+	}
+	return KubectlBasicAuthSecret{sec, newKubectlSecret(sec.Name, sec.Namespace, sec.OnExists, !credentialsConfigured(latest.Credentials{Username: sec.Username, Password: sec.Password}))}
+}
+
+// newKubectlSSHAuthSecret is a helper function for dealing with the
+// latest.KubectlSSHAuthSecret to KubectlSSHAuthSecret type definition
+func newKubectlSSHAuthSecret(sec latest.KubectlSSHAuthSecret) KubectlSSHAuthSecret {
+	if sec.Namespace == "" {
+		sec.Namespace = "default"
+	}
+	return KubectlSSHAuthSecret{sec, newKubectlSecret(sec.Name, sec.Namespace, sec.OnExists, false)}
+}
+
+// newKubectlServiceAccountTokenSecret is a helper function for dealing with the
+// latest.KubectlServiceAccountTokenSecret to KubectlServiceAccountTokenSecret type definition
+func newKubectlServiceAccountTokenSecret(sec latest.KubectlServiceAccountTokenSecret) KubectlServiceAccountTokenSecret {
+	if sec.Namespace == "" {
+		sec.Namespace = "default"
+	}
+	return KubectlServiceAccountTokenSecret{sec, newKubectlSecret(sec.Name, sec.Namespace, sec.OnExists, false)}
 }
 
 // newKubectlManifests is a helper function for dealing with the latest.KubectlManifest
@@ -264,23 +432,13 @@ func newKubectlManifests(mans []latest.KubectlManifest) KubectlManifests {
 	return m
 }
 
-// newKubectlGenericSecrets is a helper function for dealing with the
-// latest.KubectlGenericSecrets to KubectlGenericSecrets type definition
-func newKubectlGenericSecrets(secs []latest.KubectlGenericSecret) KubectlGenericSecrets {
-	var s KubectlGenericSecrets
-	for _, sec := range secs {
-		s = append(s, newKubectlGenericSecret(sec))
-	}
-	return s
-}
-
-// newKubectlDockerRegistrySecrets is a helper function for dealing with the
-// latest.KubectlDockerRegistrySecrets to KubectlDockerRegistrySecrets type
-// definition
-func newKubectlDockerRegistrySecrets(secs []latest.KubectlDockerRegistrySecret) KubectlDockerRegistrySecrets {
-	var s KubectlDockerRegistrySecrets
+// newKubectlSecrets is a helper function for dealing with a slice of one kind
+// of latest secret to a slice of the matching Kubernetes secret type, given the
+// function that converts each of them
+func newKubectlSecrets[L any, S secretInstaller](secs []L, newSecret func(L) S) []S {
+	var s []S
 	for _, sec := range secs {
-		s = append(s, newKubectlDockerRegistrySecret(sec))
+		s = append(s, newSecret(sec))
 	}
 	return s
 }
@@ -294,135 +452,280 @@ func (d KubectlDeployment) getKubectlManifests() KubectlManifests {
 // getKubectlGenericSecrets is a helper function for grabbing the
 // KubectlGenericSecrets from a KubectlDeployment
 func (d KubectlDeployment) getKubectlGenericSecrets() KubectlGenericSecrets {
-	return newKubectlGenericSecrets(d.Secrets.Generic)
+	return newKubectlSecrets(d.Secrets.Generic, newKubectlGenericSecret)
 }
 
 // getKubectlDockerRegistrySecrets is a helper function for grabbing the
 // KubectlDockerRegistrySecrets from a KubectlDeployment
 func (d KubectlDeployment) getKubectlDockerRegistrySecrets() KubectlDockerRegistrySecrets {
-	return newKubectlDockerRegistrySecrets(d.Secrets.DockerRegistry)
+	return newKubectlSecrets(d.Secrets.DockerRegistry, newKubectlDockerRegistrySecret)
+}
+
+// getKubectlTLSSecrets is a helper function for grabbing the
+// KubectlTLSSecrets from a KubectlDeployment
+func (d KubectlDeployment) getKubectlTLSSecrets() KubectlTLSSecrets {
+	return newKubectlSecrets(d.Secrets.TLS, newKubectlTLSSecret)
+}
+
+// getKubectlBasicAuthSecrets is a helper function for grabbing the
+// KubectlBasicAuthSecrets from a KubectlDeployment
+func (d KubectlDeployment) getKubectlBasicAuthSecrets() KubectlBasicAuthSecrets {
+	return newKubectlSecrets(d.Secrets.BasicAuth, newKubectlBasicAuthSecret)
+}
+
+// getKubectlSSHAuthSecrets is a helper function for grabbing the
+// KubectlSSHAuthSecrets from a KubectlDeployment
+func (d KubectlDeployment) getKubectlSSHAuthSecrets() KubectlSSHAuthSecrets {
+	return newKubectlSecrets(d.Secrets.SSHAuth, newKubectlSSHAuthSecret)
+}
+
+// getKubectlServiceAccountTokenSecrets is a helper function for grabbing the
+// KubectlServiceAccountTokenSecrets from a KubectlDeployment
+func (d KubectlDeployment) getKubectlServiceAccountTokenSecrets() KubectlServiceAccountTokenSecrets {
+	return newKubectlSecrets(d.Secrets.ServiceAccountToken, newKubectlServiceAccountTokenSecret)
 }
 
 // installArgs is used to build Kubectl apply CLI args given a FlagSet
 func (m KubectlManifest) installArgs(fs *pflag.FlagSet) []string {
 	args := []string{"apply", "--namespace", m.Namespace}
+	if m.ForceConflicts && !m.ServerSide {
+		Logger.Fatalf("forceConflicts requires serverSide for the manifests in %s", m.Namespace)
+	}
+	if m.ServerSide {
+		args = append(args, "--server-side")
+	}
+	if m.FieldManager != "" {
+		args = append(args, "--field-manager", m.FieldManager)
+	} else if m.ServerSide {
+		args = append(args, "--field-manager", "kruise")
+	}
+	if m.ForceConflicts {
+		args = append(args, "--force-conflicts")
+	}
+	if m.Prune {
+		args = append(args, "--prune", "--selector", m.pruneSelector())
+	}
+	if m.stdin() {
+		return append(args, "-f", "-")
+	}
 	for _, p := range m.Paths {
 		args = append(args, "-f", p)
 	}
 	return args
 }
 
-// installArgs is used to build Kubectl create generic secret CLI args given a
-// FlagSet
-func (s KubectlGenericSecret) installArgs(fs *pflag.FlagSet) [][]string {
+// secrets is used to build the generic Kubernetes Secret objects for the given
+// namespaces, given a FlagSet
+func (s KubectlGenericSecret) secrets(fs *pflag.FlagSet, namespaces []string) []kubernetesSecret {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
 	}
-	var iargs [][]string
-	var largs []string
-	v := "***"
-	for _, l := range s.Literal {
-		if l.Val != "" {
-			largs = append(largs, "--from-literal", fmt.Sprintf("%s=%s", l.Key, l.Val))
-		} else {
-			if !d {
-				v = sensitiveInputPrompt(fmt.Sprintf("Please enter a value for key: %s", l.Key))
-			}
-			largs = append(largs, "--from-literal", fmt.Sprintf("%s=%s", l.Key, v))
+	data, err := s.data(fs, d)
+	if err != nil {
+		Logger.Fatalf("Unable to build generic secret %s: %v", s.Name, err)
+	}
+	typ := s.Type
+	if typ == "" {
+		typ = "Opaque"
+	}
+	var secrets []kubernetesSecret
+	for _, ns := range namespaces {
+		secret := newKubernetesSecret(s.Name, ns, typ, data)
+		secret.Metadata.Labels = keyValMap(s.Labels)
+		secret.Metadata.Annotations = keyValMap(s.Annotations)
+		secrets = append(secrets, secret)
+	}
+	return secrets
+}
+
+// secrets is used to build the docker-registry Kubernetes Secret objects, one
+// per namespace, given a FlagSet
+func (s KubectlDockerRegistrySecret) secrets(fs *pflag.FlagSet, namespaces []string) []kubernetesSecret {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	u := redacted
+	p := redacted
+	if !d {
+		u, p = promptCredentials(fs, s.Credentials, s.Registry, fmt.Sprintf("the %s registry", s.Registry))
+	}
+	registerSecret(p)
+	data := map[string][]byte{
+		".dockerconfigjson": dockerConfigJSON(s.Registry, u, p),
+	}
+	var secrets []kubernetesSecret
+	for _, ns := range namespaces {
+		secrets = append(secrets, newKubernetesSecret(s.Name, ns, "kubernetes.io/dockerconfigjson", data))
+	}
+	return secrets
+}
+
+// secrets is used to build the tls Kubernetes Secret objects for the
+// given namespaces, given a FlagSet
+func (s KubectlTLSSecret) secrets(fs *pflag.FlagSet, namespaces []string) []kubernetesSecret {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	// a self-signed certificate that was already deployed is reused so that
+	// redeploying it doesn't change the secret
+	cert, key, ok := s.deployedCertificate(d, namespaces)
+	if !ok {
+		cert, key, err = s.certificate(d)
+		if err != nil {
+			Logger.Fatalf("Unable to build tls secret %s: %v", s.Name, err)
 		}
 	}
-	for _, ns := range s.Namespaces {
-		args := []string{"create", "secret", "generic", s.Name}
-		if ns != "" && ns != "default" {
-			args = append(args, "--namespace", ns)
+	registerSecret(string(key))
+	data := map[string][]byte{
+		"tls.crt": cert,
+		"tls.key": key,
+	}
+	var secrets []kubernetesSecret
+	for _, ns := range namespaces {
+		sec := newKubernetesSecret(s.Name, ns, "kubernetes.io/tls", data)
+		if s.selfSigned() {
+			sec.Metadata.Annotations = map[string]string{selfSignedAnnotation: s.selfSignedHash()}
 		}
-		args = append(args, largs...)
-		iargs = append(iargs, args)
+		secrets = append(secrets, sec)
 	}
-	return iargs
+	return secrets
 }
 
-// installArgs is used to build Kubectl create docker-registry secret CLI args
-// given a FlagSet
-func (s KubectlDockerRegistrySecret) installArgs(fs *pflag.FlagSet) [][]string {
+// secrets is used to build the basic-auth Kubernetes Secret objects for the
+// given namespaces, given a FlagSet
+func (s KubectlBasicAuthSecret) secrets(fs *pflag.FlagSet, namespaces []string) []kubernetesSecret {
 	d, err := fs.GetBool("dry-run")
 	if err != nil {
 		Logger.Fatal(err)
 	}
-	var iargs [][]string
-	var dargs []string
-	u := "***"
-	p := "***"
-	dargs = append(dargs, "--docker-server", s.Registry)
+	u := redacted
+	p := redacted
 	if !d {
-		u = normalInputPrompt("Please enter a username")
-		p = sensitiveInputPrompt("Please enter a password")
+		creds := latest.Credentials{Username: s.Username, Password: s.Password}
+		u, p = promptCredentials(fs, creds, "", fmt.Sprintf("the %s secret", s.Name))
 	}
-	dargs = append(dargs, "--docker-username", u, "--docker-password", string(p))
-	for _, ns := range s.Namespaces {
-		args := []string{"create", "secret", "docker-registry", s.Name}
-		if ns != "" && ns != "default" {
-			args = append(args, "--namespace", ns)
-		}
-		args = append(args, dargs...)
-		iargs = append(iargs, args)
+	registerSecret(p)
+	data := map[string][]byte{
+		"username": []byte(u),
+		"password": []byte(p),
+	}
+	var secrets []kubernetesSecret
+	for _, ns := range namespaces {
+		secrets = append(secrets, newKubernetesSecret(s.Name, ns, "kubernetes.io/basic-auth", data))
 	}
-	return iargs
+	return secrets
 }
 
-// uninstallArgs is used to build Kubectl delete CLI args given a FlagSet
-func (m KubectlManifest) uninstallArgs(fs *pflag.FlagSet) []string {
-	args := []string{"delete", "--namespace", m.Namespace}
-	for _, p := range m.Paths {
-		args = append(args, "-f", p)
+// secrets is used to build the ssh-auth Kubernetes Secret objects for the
+// given namespaces, given a FlagSet
+func (s KubectlSSHAuthSecret) secrets(fs *pflag.FlagSet, namespaces []string) []kubernetesSecret {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
 	}
-	return args
+	data, err := s.data(d)
+	if err != nil {
+		Logger.Fatalf("Unable to build ssh-auth secret %s: %v", s.Name, err)
+	}
+	var secrets []kubernetesSecret
+	for _, ns := range namespaces {
+		secrets = append(secrets, newKubernetesSecret(s.Name, ns, "kubernetes.io/ssh-auth", data))
+	}
+	return secrets
 }
 
-// uninstallArgs is used to build Kubectl delete secret CLI args given a FlagSet
-func (s KubectlGenericSecret) uninstallArgs(fs *pflag.FlagSet) [][]string {
-	var uargs [][]string
-	for _, ns := range s.Namespaces {
-		args := []string{"delete", "secret", s.Name}
-		if ns != "" && ns != "default" {
-			args = append(args, "--namespace", ns)
+// secrets is used to build the service-account-token Kubernetes Secret
+// objects for the given namespaces, given a FlagSet
+//
+// The token itself is populated by Kubernetes once the secret is created.
+func (s KubectlServiceAccountTokenSecret) secrets(fs *pflag.FlagSet, namespaces []string) []kubernetesSecret {
+	if s.ServiceAccount == "" {
+		Logger.Fatalf("Unable to build service-account-token secret %s: no serviceAccount was given", s.Name)
+	}
+	var secrets []kubernetesSecret
+	for _, ns := range namespaces {
+		secret := newKubernetesSecret(s.Name, ns, "kubernetes.io/service-account-token", nil)
+		secret.Metadata.Annotations = map[string]string{
+			"kubernetes.io/service-account.name": s.ServiceAccount,
 		}
-		uargs = append(uargs, args)
+		secrets = append(secrets, secret)
 	}
-	return uargs
+	return secrets
 }
 
-// uninstallArgs is used to build Kubectl delete secret CLI args given a FlagSet
-func (s KubectlDockerRegistrySecret) uninstallArgs(fs *pflag.FlagSet) [][]string {
-	var uargs [][]string
-	for _, ns := range s.Namespaces {
-		args := []string{"delete", "secret", s.Name}
-		if ns != "" && ns != "default" {
-			args = append(args, "--namespace", ns)
-		}
-		uargs = append(uargs, args)
+// uninstallArgs is used to build Kubectl delete CLI args given a FlagSet
+func (m KubectlManifest) uninstallArgs(fs *pflag.FlagSet) []string {
+	args := []string{"delete", "--namespace", m.Namespace}
+	if m.stdin() {
+		return append(args, "-f", "-")
+	}
+	for _, p := range m.Paths {
+		args = append(args, "-f", p)
 	}
-	return uargs
+	return args
 }
 
 // hash is used to facilitate storing KubectlManifests in a map
+//
+// Templated manifests render differently for every deployment and pruned
+// manifests are labelled with their deployment, so they are only the same if
+// they belong to the same deployment as well.
 func (m *KubectlManifest) hash() string {
 	h := sha1.New()
 	for _, p := range m.Paths {
-		h.Write([]byte(p))
+		h.Write([]byte(p + "\x00"))
+	}
+	h.Write([]byte(m.Namespace + "\x00"))
+	fmt.Fprintf(h, "%t\x00%t\x00%s\x00%t\x00", m.ServerSide, m.ForceConflicts, m.FieldManager, m.Prune)
+	if m.Template || m.Prune {
+		h.Write([]byte(m.Deployment + "\x00"))
+	}
+	if m.Template {
+		hashReleases(h, m.Releases)
+		h.Write([]byte(strings.Join(m.Env, "\x00") + "\x00"))
 	}
 	return base64.URLEncoding.EncodeToString(h.Sum(nil))
 }
 
+// hashReleases is used to write the release names of a deployment to a hash
+// in a stable order
+func hashReleases(h hash.Hash, releases map[string]string) {
+	var charts []string
+	for c := range releases {
+		charts = append(charts, c)
+	}
+	sort.Strings(charts)
+	for _, c := range charts {
+		h.Write([]byte(c + "\x00" + releases[c] + "\x00"))
+	}
+}
+
 // hash is used to facilitate storing KubectlGenericSecrets in a map
 func (s *KubectlGenericSecret) hash() string {
 	h := sha1.New()
 	h.Write([]byte(s.Name))
+	h.Write([]byte(s.Type))
 	for _, l := range s.Literal {
 		h.Write([]byte(l.Key))
 		h.Write([]byte(l.Val))
+		h.Write([]byte(l.Ref))
+	}
+	for _, f := range s.FromFile {
+		h.Write([]byte(f.Key))
+		h.Write([]byte(f.Path))
+	}
+	for _, f := range s.FromEnvFile {
+		h.Write([]byte(f))
 	}
+	for _, c := range s.FromCommand {
+		h.Write([]byte(c.Key))
+		h.Write([]byte(c.Command))
+	}
+	hashKeyVals(h, "labels", s.Labels)
+	hashKeyVals(h, "annotations", s.Annotations)
 	return base64.URLEncoding.EncodeToString(h.Sum(nil))
 }
 
@@ -434,34 +737,274 @@ func (s *KubectlDockerRegistrySecret) hash() string {
 	return base64.URLEncoding.EncodeToString(h.Sum(nil))
 }
 
+// hash is used to facilitate storing KubectlTLSSecrets in a map
+func (s *KubectlTLSSecret) hash() string {
+	h := sha1.New()
+	h.Write([]byte(s.Name))
+	h.Write([]byte(s.Cert))
+	h.Write([]byte(s.Key))
+	for _, host := range s.SelfSigned.Hosts {
+		h.Write([]byte(host))
+	}
+	h.Write([]byte(s.SelfSigned.ValidFor))
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hash is used to facilitate storing KubectlBasicAuthSecrets in a map
+func (s *KubectlBasicAuthSecret) hash() string {
+	h := sha1.New()
+	h.Write([]byte(s.Name))
+	hashSecretSource(h, s.Username)
+	hashSecretSource(h, s.Password)
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hash is used to facilitate storing KubectlSSHAuthSecrets in a map
+func (s *KubectlSSHAuthSecret) hash() string {
+	h := sha1.New()
+	h.Write([]byte(s.Name))
+	hashSecretSource(h, s.PrivateKey)
+	hashSecretSource(h, s.KnownHosts)
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hash is used to facilitate storing KubectlServiceAccountTokenSecrets in a
+// map
+func (s *KubectlServiceAccountTokenSecret) hash() string {
+	h := sha1.New()
+	h.Write([]byte(s.Name))
+	h.Write([]byte(s.ServiceAccount))
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
+
+// hashKeyVals is used to write a named list of KeyVals to a hash
+//
+// Every key and value is terminated so that lists with the same content under
+// a different name, or split differently into keys and values, hash
+// differently.
+func hashKeyVals(h hash.Hash, name string, kvs []latest.KeyVal) {
+	h.Write([]byte(name + "\x00"))
+	for _, kv := range kvs {
+		h.Write([]byte(kv.Key + "\x00" + kv.Val + "\x00"))
+	}
+}
+
+// hashSecretSource is used to write the fields of a SecretSource to a hash
+func hashSecretSource(h hash.Hash, src latest.SecretSource) {
+	h.Write([]byte(src.Value))
+	h.Write([]byte(src.Env))
+	h.Write([]byte(src.File))
+	h.Write([]byte(src.Command))
+	h.Write([]byte(src.Ref))
+}
+
+// installSecrets is used to create or update the Kubernetes Secret objects
+// built by the given function, along with their namespaces
+//
+// Secrets are applied in place so that there's never a window where they
+// don't exist, and are skipped entirely if their content hasn't changed. The
+// force-recreate flag deletes and recreates them instead.
+func installSecrets(fs *pflag.FlagSet, out io.Writer, kind string, name string, id string, onExists string, namespaces []string, build func(*pflag.FlagSet, []string) []kubernetesSecret) error {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	force, err := fs.GetBool("force-recreate")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if !d {
+		checkKubectl()
+	}
+	if out == nil {
+		out = stdoutWriter()
+	}
+	for _, ns := range namespaces {
+		err = kubectlCreateNamespace(out, d, ns)
+		if err != nil {
+			Logger.Debug(err)
+		}
+	}
+	p := prepareSecrets(fs, kind, name, id, onExists, namespaces, build)
+	if len(p.namespaces) == 0 {
+		return nil
+	}
+	verb := "Applying"
+	if force {
+		uninstallSecrets(fs, out, name, p.namespaces)
+		verb = "Recreating"
+	}
+	switch len(p.namespaces) {
+	case 1:
+		fmt.Fprintf(out, "%s %s secret %s in the %s namespace\n", verb, kind, name, p.namespaces[0])
+	default:
+		fmt.Fprintf(out, "%s %s secret %s in the %s namespaces\n", verb, kind, name, p.namespaces)
+	}
+	// every namespace is attempted, with the first failure wrapped so that
+	// its exit code is reported
+	var first error
+	var failed []string
+	for _, secret := range p.secrets {
+		secret = secret.withContentHash()
+		if !d && !force && secret.unchanged() {
+			fmt.Fprintf(out, "Skipping %s secret %s in the %s namespace since it is unchanged\n", kind, name, secret.Metadata.Namespace)
+			continue
+		}
+		err = kubectlApplySecret(out, d, secret)
+		switch {
+		case err == nil:
+		case first == nil:
+			first = err
+		default:
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%w\n%s", first, strings.Join(failed, "\n"))
+	}
+	return first
+}
+
+// prepareSecrets is used to determine which of the given namespaces the named
+// secret should be applied to and build its Kubernetes Secret objects for
+// them, which may prompt the user
+//
+// The result is kept for the rest of the run so that the secret can be
+// prepared up front and installed later without any further input. It is
+// keyed by the hash of the secret's installer, given as id, so that two
+// secrets that share a name but not their content are prepared separately.
+// Namespaces that already have the secret are handled according to the
+// onExists policy before anything is prompted for.
+func prepareSecrets(fs *pflag.FlagSet, kind string, name string, id string, onExists string, namespaces []string, build func(*pflag.FlagSet, []string) []kubernetesSecret) preparedSecret {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	force, err := fs.GetBool("force-recreate")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	key := fmt.Sprintf("%s/%s/%s", kind, id, strings.Join(namespaces, ","))
+	// only the lookup of the entry is guarded by the global lock, so that
+	// preparing one secret doesn't hold up installers of any other
+	preparedSecrets.mu.Lock()
+	e, ok := preparedSecrets.m[key]
+	if !ok {
+		e = &preparedSecretEntry{}
+		preparedSecrets.m[key] = e
+	}
+	preparedSecrets.mu.Unlock()
+	e.once.Do(func() {
+		p := preparedSecret{namespaces: namespaces}
+		if !d && !force {
+			p.namespaces = pendingSecretNamespaces(fs, kind, name, onExists, namespaces)
+		}
+		if len(p.namespaces) > 0 {
+			p.secrets = build(fs, p.namespaces)
+		}
+		e.prepared = p
+	})
+	return e.prepared
+}
+
+// pendingSecretNamespaces is used to get the namespaces that the named secret
+// should be applied to given its onExists policy
+//
+// The update policy applies the secret everywhere, leaving it to the content
+// hash to skip the ones that are unchanged. With the skip policy, namespaces
+// that already have the secret keep it; prompt asks whether to overwrite it
+// and overwrite always does.
+func pendingSecretNamespaces(fs *pflag.FlagSet, kind string, name string, onExists string, namespaces []string) []string {
+	if onExists == "update" {
+		return namespaces
+	}
+	var pending []string
+	for _, ns := range namespaces {
+		if !kubectlSecretExists(name, ns) {
+			pending = append(pending, ns)
+			continue
+		}
+		switch onExists {
+		case "skip":
+			fmt.Fprintf(stdoutWriter(), "Keeping the existing %s secret %s in the %s namespace\n", kind, name, ns)
+		case "prompt":
+			if confirmPrompt(fs, fmt.Sprintf("The %s secret %s already exists in the %s namespace. Overwrite it?", kind, name, ns)) {
+				pending = append(pending, ns)
+			} else {
+				fmt.Fprintf(stdoutWriter(), "Keeping the existing %s secret %s in the %s namespace\n", kind, name, ns)
+			}
+		case "overwrite":
+			pending = append(pending, ns)
+		}
+	}
+	return pending
+}
+
+// kubectlSecretExists is used to determine whether the named secret exists in
+// the given namespace
+func kubectlSecretExists(name string, ns string) bool {
+	_, err := NewCmd("kubectl").
+		WithArgs([]string{"get", "secret", name, "--namespace", ns, "--output", "name"}).
+		Build().
+		Output()
+	return err == nil
+}
+
+// uninstallSecrets is used to execute a Kubectl delete secret command for the
+// named secret in each of the given namespaces
+func uninstallSecrets(fs *pflag.FlagSet, out io.Writer, name string, namespaces []string) {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if !d {
+		checkKubectl()
+	}
+	for _, ns := range namespaces {
+		args := []string{"delete", "secret", name}
+		if ns != "" && ns != "default" {
+			args = append(args, "--namespace", ns)
+		}
+		Logger.Debugf("%s %s", "kubectl", strings.Join(args, " "))
+		err = kubectlDeleteSecret(out, d, args)
+		if err != nil {
+			Logger.Debug(err)
+		}
+	}
+}
+
 // kubectlCreateNamespace is used to execute a kubectl create namespace command
 // hides unnecessary output
-func kubectlCreateNamespace(dry bool, n string) error {
+func kubectlCreateNamespace(out io.Writer, dry bool, n string) error {
 	return NewCmd("kubectl").
 		WithArgs([]string{"create", "namespace", n}).
 		WithDryRun(dry).
 		WithNoStdOut().
+		WithOutput(out).
 		Build().
 		Execute()
 }
 
 // kubectlDeleteSecret is used to execute a kubectl delete secret command
 // hides unnecessary output
-func kubectlDeleteSecret(dry bool, args []string) error {
+func kubectlDeleteSecret(out io.Writer, dry bool, args []string) error {
 	return NewCmd("kubectl").
 		WithArgs(args).
 		WithDryRun(dry).
 		WithNoStdOut().
+		WithOutput(out).
 		Build().
 		Execute()
 }
 
 // kubectlExecute is a helper function for executing a Kubectl command given a set of
-// args; it will print the command instead of executing it if dry is true
-func kubectlExecute(dry bool, args []string) error {
+// args, writing its output to out; it will print the command instead of
+// executing it if dry is true
+func kubectlExecute(out io.Writer, dry bool, args []string) error {
 	return NewCmd("kubectl").
 		WithArgs(args).
 		WithDryRun(dry).
+		WithOutput(out).
 		Build().
 		Execute()
 }
@@ -0,0 +1,102 @@
+package kruise
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingSecretNamespaces(t *testing.T) {
+	InitializeLogger()
+	// a stand-in kubectl that only knows about the app secret in the prod
+	// namespace
+	bin := t.TempDir()
+	script := "#!/bin/sh\n[ \"$3 $5\" = \"app prod\" ]\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "kubectl"), []byte(script), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("non-interactive", true, "")
+
+	namespaces := []string{"dev", "prod"}
+	assert.Equal(t, []string{"dev"}, pendingSecretNamespaces(fs, "generic", "app", "skip", namespaces))
+	assert.Equal(t, namespaces, pendingSecretNamespaces(fs, "generic", "app", "update", namespaces))
+	assert.Equal(t, namespaces, pendingSecretNamespaces(fs, "generic", "app", "overwrite", namespaces))
+	assert.Equal(t, namespaces, pendingSecretNamespaces(fs, "generic", "other", "prompt", namespaces))
+}
+
+func TestPrepareSecrets(t *testing.T) {
+	InitializeLogger()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", true, "")
+	fs.Bool("force-recreate", false, "")
+	old := preparedSecrets.m
+	preparedSecrets.m = make(map[string]*preparedSecretEntry)
+	t.Cleanup(func() { preparedSecrets.m = old })
+	builds := 0
+	build := func(fs *pflag.FlagSet, namespaces []string) []kubernetesSecret {
+		builds++
+		return nil
+	}
+	a := newKubectlGenericSecret(latest.KubectlGenericSecret{Name: "app", Literal: []latest.KeyVal{{Key: "user", Val: "a"}}})
+	b := newKubectlGenericSecret(latest.KubectlGenericSecret{Name: "app", Literal: []latest.KeyVal{{Key: "user", Val: "b"}}})
+	prepareSecrets(fs, "generic", a.Name, a.hash(), a.policy, a.Namespaces, build)
+	prepareSecrets(fs, "generic", a.Name, a.hash(), a.policy, a.Namespaces, build)
+	assert.Equal(t, 1, builds, "a secret should only be prepared once")
+	prepareSecrets(fs, "generic", b.Name, b.hash(), b.policy, b.Namespaces, build)
+	assert.Equal(t, 2, builds, "secrets with the same name but different content should be prepared separately")
+}
+
+func TestKubectlSecretPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret kubectlSecret
+		policy string
+	}{
+		{"prompted literal", newKubectlGenericSecret(latest.KubectlGenericSecret{Literal: []latest.KeyVal{{Key: "password"}}}).kubectlSecret, "skip"},
+		{"literal with a value", newKubectlGenericSecret(latest.KubectlGenericSecret{Literal: []latest.KeyVal{{Key: "user", Val: "admin"}}}).kubectlSecret, "update"},
+		{"explicit policy", newKubectlGenericSecret(latest.KubectlGenericSecret{OnExists: "prompt"}).kubectlSecret, "prompt"},
+		{"prompted credentials", newKubectlDockerRegistrySecret(latest.KubectlDockerRegistrySecret{Registry: "ghcr.io"}).kubectlSecret, "skip"},
+		{"docker config", newKubectlDockerRegistrySecret(latest.KubectlDockerRegistrySecret{Credentials: latest.Credentials{DockerConfig: "~/.docker/config.json"}}).kubectlSecret, "update"},
+		{"self-signed certificate", newKubectlTLSSecret(latest.KubectlTLSSecret{SelfSigned: latest.SelfSignedCert{Hosts: []string{"localhost"}}}).kubectlSecret, "skip"},
+		{"certificate files", newKubectlTLSSecret(latest.KubectlTLSSecret{Cert: "tls.crt", Key: "tls.key"}).kubectlSecret, "update"},
+		{"service account token", newKubectlServiceAccountTokenSecret(latest.KubectlServiceAccountTokenSecret{}).kubectlSecret, "update"},
+		{"explicit update of a prompted literal", newKubectlGenericSecret(latest.KubectlGenericSecret{OnExists: "update", Literal: []latest.KeyVal{{Key: "password"}}}).kubectlSecret, "update"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.policy, tt.secret.policy, tt.name)
+	}
+}
+
+func TestKubectlGenericSecretHash(t *testing.T) {
+	secret := func(labels []latest.KeyVal, annotations []latest.KeyVal) *KubectlGenericSecret {
+		return &KubectlGenericSecret{KubectlGenericSecret: latest.KubectlGenericSecret{Name: "app", Labels: labels, Annotations: annotations}}
+	}
+	kv := []latest.KeyVal{{Key: "team", Val: "platform"}}
+	assert.NotEqual(t, secret(kv, nil).hash(), secret(nil, kv).hash())
+	assert.NotEqual(t, secret(kv, nil).hash(), secret([]latest.KeyVal{{Key: "teamp", Val: "latform"}}, nil).hash())
+	// hashing must not write the annotations into spare capacity of the labels
+	labels := make([]latest.KeyVal, 1, 2)
+	copy(labels, kv)
+	secret(labels, []latest.KeyVal{{Key: "a", Val: "b"}}).hash()
+	assert.Equal(t, latest.KeyVal{}, labels[:2][1])
+}
+
+func TestAddSecrets(t *testing.T) {
+	generic := func(name string, ns string) KubectlGenericSecret {
+		return newKubectlGenericSecret(latest.KubectlGenericSecret{Name: name, Namespace: ns})
+	}
+	set := &secretSet{index: make(map[string]int)}
+	addSecrets(set, []KubectlGenericSecret{generic("b", "dev"), generic("a", "dev")})
+	addSecrets(set, []KubectlDockerRegistrySecret{newKubectlDockerRegistrySecret(latest.KubectlDockerRegistrySecret{Name: "b"})})
+	addSecrets(set, []KubectlGenericSecret{generic("b", "prod"), generic("b", "dev")})
+	var names []string
+	for _, i := range set.installers {
+		typ, name, ns := describe(i)
+		names = append(names, typ+" "+name+" "+ns)
+	}
+	assert.Equal(t, []string{"secret b dev, prod", "secret a dev", "secret b default"}, names)
+}
@@ -0,0 +1,124 @@
+package kruise
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+)
+
+type (
+	// KubectlKustomization represents information about a kustomization
+	KubectlKustomization latest.KubectlKustomization
+	// KubectlKustomizations represents a slice of KubectlKustomization objects
+	KubectlKustomizations []KubectlKustomization
+)
+
+// Install is used to execute a Kubectl apply -k command
+func (k KubectlKustomization) Install(fs *pflag.FlagSet, out io.Writer) error {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if !d {
+		checkKubectl()
+	}
+	// a kustomization may set the namespace of its resources itself
+	if k.Namespace != "" {
+		err = kubectlCreateNamespace(out, d, k.Namespace)
+		if err != nil {
+			Logger.Debug(err)
+		}
+	}
+	return kubectlExecute(out, d, k.installArgs(fs))
+}
+
+// Uninstall is used to execute a Kubectl delete -k command
+func (k KubectlKustomization) Uninstall(fs *pflag.FlagSet, out io.Writer) error {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if !d {
+		checkKubectl()
+	}
+	err = kubectlExecute(out, d, k.uninstallArgs(fs))
+	if err != nil {
+		Logger.Warn(err)
+	}
+	return nil
+}
+
+// GetPriority is used to get the priority of the installer
+func (k KubectlKustomization) GetPriority() int {
+	return k.Priority
+}
+
+// IsInit is used to determine whether the installer should be installed during
+// initialization
+func (k KubectlKustomization) IsInit() bool {
+	return k.Init
+}
+
+// newKubectlKustomization is a helper function for dealing with the
+// latest.KubectlKustomization to KubectlKustomization type definition
+func newKubectlKustomization(kus latest.KubectlKustomization) KubectlKustomization {
+	return KubectlKustomization(kus)
+}
+
+// newKubectlKustomizations is a helper function for dealing with the
+// latest.KubectlKustomization to KubectlKustomization type definition
+func newKubectlKustomizations(kuss []latest.KubectlKustomization) KubectlKustomizations {
+	var k KubectlKustomizations
+	for _, kus := range kuss {
+		k = append(k, newKubectlKustomization(kus))
+	}
+	return k
+}
+
+// getKubectlKustomizations is a helper function for grabbing the
+// KubectlKustomizations from a KubectlDeployment
+func (d KubectlDeployment) getKubectlKustomizations() KubectlKustomizations {
+	return newKubectlKustomizations(d.Kustomizations)
+}
+
+// installArgs is used to build Kubectl apply -k CLI args given a FlagSet
+func (k KubectlKustomization) installArgs(fs *pflag.FlagSet) []string {
+	if k.Path == "" {
+		Logger.Fatal("You must specify a kustomization path")
+	}
+	args := []string{"apply", "-k", k.Path}
+	if k.Namespace != "" {
+		args = append(args, "--namespace", k.Namespace)
+	}
+	return args
+}
+
+// uninstallArgs is used to build Kubectl delete -k CLI args given a FlagSet
+func (k KubectlKustomization) uninstallArgs(fs *pflag.FlagSet) []string {
+	if k.Path == "" {
+		Logger.Fatal("You must specify a kustomization path")
+	}
+	args := []string{"delete", "-k", k.Path}
+	if k.Namespace != "" {
+		args = append(args, "--namespace", k.Namespace)
+	}
+	return args
+}
+
+// hash is used to facilitate storing KubectlKustomizations in a map
+//
+// Every field is hashed, since kustomizations that differ in any of them are
+// installed differently.
+func (k *KubectlKustomization) hash() string {
+	h := sha1.New()
+	h.Write([]byte(k.Path + "\x00" + k.Namespace + "\x00"))
+	fmt.Fprintf(h, "%d\x00%t\x00", k.Priority, k.Init)
+	for _, w := range k.WaitFor {
+		fmt.Fprintf(h, "%+v\x00", w)
+	}
+	return base64.URLEncoding.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,64 @@
+package kruise
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKubectlKustomizationArgs(t *testing.T) {
+	k := KubectlKustomization{Path: "overlays/dev"}
+	assert.Equal(t, []string{"apply", "-k", "overlays/dev"}, k.installArgs(nil))
+	k.Namespace = "monitoring"
+	assert.Equal(t, []string{"apply", "-k", "overlays/dev", "--namespace", "monitoring"}, k.installArgs(nil))
+	assert.Equal(t, []string{"delete", "-k", "overlays/dev", "--namespace", "monitoring"}, k.uninstallArgs(nil))
+	same := KubectlKustomization{Path: "overlays/dev", Namespace: "monitoring"}
+	assert.Equal(t, k.hash(), same.hash())
+	for _, other := range []KubectlKustomization{
+		{Path: "overlays/dev", Namespace: "monitoring", Priority: 3},
+		{Path: "overlays/dev", Namespace: "monitoring", Init: true},
+		{Path: "overlays/dev", Namespace: "monitoring", WaitFor: []latest.WaitCondition{{Rollout: "deployment/grafana"}}},
+	} {
+		assert.NotEqual(t, k.hash(), other.hash(), "%+v", other)
+	}
+}
+
+func TestKubectlKustomizationInstall(t *testing.T) {
+	InitializeLogger()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", true, "")
+	var buf bytes.Buffer
+	output = &buf
+	t.Cleanup(func() { output = nil })
+	KubectlKustomization{Path: "overlays/dev", Namespace: "monitoring"}.Install(fs, nil)
+	KubectlKustomization{Path: "https://github.com/kubernetes-sigs/metrics-server//manifests/base?ref=v0.6.3"}.Install(fs, nil)
+	out := buf.String()
+	assert.Contains(t, out, "kubectl create namespace monitoring\n")
+	assert.Contains(t, out, "kubectl apply -k overlays/dev --namespace monitoring\n")
+	assert.Contains(t, out, "kubectl apply -k https://github.com/kubernetes-sigs/metrics-server//manifests/base?ref=v0.6.3\n")
+	assert.Equal(t, 1, strings.Count(out, "create namespace"), "kustomizations without a namespace shouldn't create one")
+}
+
+func TestKubectlKustomizationsDeduplicated(t *testing.T) {
+	InitializeLogger()
+	kus := latest.KubectlKustomization{Path: "overlays/dev", Namespace: "monitoring"}
+	dep := func(name string, kustomizations ...latest.KubectlKustomization) latest.Deployment {
+		return latest.Deployment{Name: name, Kubectl: latest.KubectlDeployment{Kustomizations: kustomizations}}
+	}
+	old := Kfg
+	Kfg = &Konfig{}
+	Kfg.Manifest.Deploy.Deployments = []latest.Deployment{
+		dep("grafana", kus),
+		dep("prometheus", kus, latest.KubectlKustomization{Path: "overlays/dev", Namespace: "observability"}),
+	}
+	t.Cleanup(func() { Kfg = old })
+	installers := getAllPassedInstallers([]string{"grafana", "prometheus"})
+	assert.Equal(t, Installers{
+		KubectlKustomization(kus),
+		KubectlKustomization{Path: "overlays/dev", Namespace: "observability"},
+	}, installers)
+}
@@ -0,0 +1,240 @@
+package kruise
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/pflag"
+)
+
+type (
+	// listing represents the deployments and profiles printed by kruise list
+	listing struct {
+		Deployments []deploymentListing `json:"deployments,omitempty" yaml:"deployments,omitempty"`
+		Profiles    []profileListing    `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	}
+
+	// deploymentListing represents a deployment printed by kruise list
+	deploymentListing struct {
+		Name        string             `json:"name" yaml:"name"`
+		Aliases     []string           `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+		Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+		Profiles    []string           `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+		Installers  []installerListing `json:"installers,omitempty" yaml:"installers,omitempty"`
+	}
+
+	// installerListing represents an Installer of a deployment printed by
+	// kruise list
+	installerListing struct {
+		Type      string `json:"type" yaml:"type"`
+		Name      string `json:"name" yaml:"name"`
+		Namespace string `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+		Priority  int    `json:"priority" yaml:"priority"`
+		Init      bool   `json:"init,omitempty" yaml:"init,omitempty"`
+	}
+
+	// profileListing represents a profile printed by kruise list
+	profileListing struct {
+		Name        string   `json:"name" yaml:"name"`
+		Aliases     []string `json:"aliases,omitempty" yaml:"aliases,omitempty"`
+		Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+		Deployments []string `json:"deployments,omitempty" yaml:"deployments,omitempty"`
+	}
+)
+
+// List prints the deployments and/or profiles of the config, depending on the
+// passed argument, in the format given by the output flag
+//
+// Deployments are filtered to those with an Installer in the given namespace
+// and of the given type, if either flag is set, and profiles to those that
+// include a deployment that is left.
+func List(fs *pflag.FlagSet, args []string) {
+	out, err := fs.GetString("output")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	ns, err := fs.GetString("namespace")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	typ, err := fs.GetString("type")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	switch typ {
+	case "", "chart", "repository", "manifest", "kustomization", "secret", "exec":
+	default:
+		Logger.Fatalf("Invalid installer type %q, expected chart, repository, manifest, kustomization, secret or exec", typ)
+	}
+	what := "all"
+	if len(args) > 0 {
+		what = args[0]
+	}
+	l := newListing(ns, typ)
+	switch what {
+	case "deployments":
+		l.Profiles = nil
+	case "profiles":
+		l.Deployments = nil
+	}
+	if err := l.print(redactWriter{os.Stdout}, out, what); err != nil {
+		Logger.Fatal(err)
+	}
+}
+
+// newListing is used to build a listing of every deployment and profile in the
+// config, filtered by the given namespace and installer type
+func newListing(ns string, typ string) listing {
+	profiles := GetDeployProfiles()
+	included := make(map[string][]string)
+	for _, p := range profiles {
+		for _, item := range p.Items {
+			if d, ok := argIsDeployment(item); ok {
+				included[d.Name] = append(included[d.Name], p.Name)
+			}
+		}
+	}
+	var l listing
+	left := make(map[string]bool)
+	for _, d := range GetDeployments() {
+		dl := deploymentListing{
+			Name:        d.Name,
+			Aliases:     d.Aliases,
+			Description: d.Description.Deploy,
+			Profiles:    included[d.Name],
+		}
+		for _, i := range getAllPassedInstallers([]string{d.Name}) {
+			t, name, n := describe(i)
+			il := installerListing{Type: t, Name: name, Namespace: n, Priority: i.GetPriority(), Init: i.IsInit()}
+			if (typ == "" || typ == t) && (ns == "" || contains(strings.Split(n, ", "), ns)) {
+				dl.Installers = append(dl.Installers, il)
+			}
+		}
+		if (typ != "" || ns != "") && len(dl.Installers) == 0 {
+			continue
+		}
+		left[d.Name] = true
+		l.Deployments = append(l.Deployments, dl)
+	}
+	for _, p := range profiles {
+		pl := profileListing{Name: p.Name, Aliases: p.Aliases, Description: p.Description.Deploy}
+		keep := false
+		for _, item := range p.Items {
+			if d, ok := argIsDeployment(item); ok {
+				pl.Deployments = append(pl.Deployments, d.Name)
+				keep = keep || left[d.Name]
+			}
+		}
+		if keep || (typ == "" && ns == "") {
+			l.Profiles = append(l.Profiles, pl)
+		}
+	}
+	return l
+}
+
+// print is used to write the listing as a table, a wide table, JSON or YAML
+func (l listing) print(w io.Writer, out string, what string) error {
+	switch out {
+	case "json":
+		var v interface{} = l
+		switch what {
+		case "deployments":
+			v = l.Deployments
+		case "profiles":
+			v = l.Profiles
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	case "yaml":
+		var v interface{} = l
+		switch what {
+		case "deployments":
+			v = l.Deployments
+		case "profiles":
+			v = l.Profiles
+		}
+		b, err := marshalYAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	case "table", "wide":
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		wide := out == "wide"
+		if what != "profiles" {
+			l.printDeployments(tw, wide)
+		}
+		if what == "all" {
+			fmt.Fprintln(tw)
+		}
+		if what != "deployments" {
+			l.printProfiles(tw, wide)
+		}
+		return tw.Flush()
+	}
+	return fmt.Errorf("invalid output format %q, expected table, wide, json or yaml", out)
+}
+
+// printDeployments is used to write a row per deployment, or a row per
+// Installer of each deployment if wide is set
+func (l listing) printDeployments(w io.Writer, wide bool) {
+	if !wide {
+		fmt.Fprintln(w, "DEPLOYMENT\tDESCRIPTION")
+		for _, d := range l.Deployments {
+			fmt.Fprintf(w, "%s\t%s\n", d.Name, d.Description)
+		}
+		return
+	}
+	fmt.Fprintln(w, "DEPLOYMENT\tALIASES\tTYPE\tNAME\tNAMESPACE\tPRIORITY\tPROFILES\tDESCRIPTION")
+	for _, d := range l.Deployments {
+		first := []string{d.Name, orNone(d.Aliases), "", "", "", "", orNone(d.Profiles), d.Description}
+		if len(d.Installers) == 0 {
+			fmt.Fprintln(w, strings.Join(first, "\t"))
+		}
+		for n, i := range d.Installers {
+			row := []string{"", "", i.Type, i.Name, i.Namespace, strconv.Itoa(i.Priority), "", ""}
+			if n == 0 {
+				row[0], row[1], row[6], row[7] = first[0], first[1], first[6], first[7]
+			}
+			if i.Namespace == "" {
+				row[4] = "-"
+			}
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+	}
+}
+
+// printProfiles is used to write a row per profile, with its aliases and
+// deployments if wide is set
+func (l listing) printProfiles(w io.Writer, wide bool) {
+	if !wide {
+		fmt.Fprintln(w, "PROFILE\tDESCRIPTION")
+		for _, p := range l.Profiles {
+			fmt.Fprintf(w, "%s\t%s\n", p.Name, p.Description)
+		}
+		return
+	}
+	fmt.Fprintln(w, "PROFILE\tALIASES\tDEPLOYMENTS\tDESCRIPTION")
+	for _, p := range l.Profiles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, orNone(p.Aliases), orNone(p.Deployments), p.Description)
+	}
+}
+
+// orNone is used to join the given values for a table, or get a dash if there
+// are none
+func orNone(s []string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, ",")
+}
@@ -0,0 +1,388 @@
+package kruise
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Lockfile represents the chart versions and digests that Helm chart
+	// version constraints were resolved to
+	Lockfile struct {
+		Path   string       `yaml:"-"`
+		Charts LockedCharts `yaml:"charts"`
+		// warned holds the charts that have been reported as out of date, so
+		// that each is only reported once
+		warned sync.Map
+	}
+	// LockedChart represents a Helm chart version constraint resolved to an
+	// exact version and digest
+	LockedChart struct {
+		Repository string `yaml:"repository"`
+		Chart      string `yaml:"chart"`
+		Constraint string `yaml:"constraint"`
+		Version    string `yaml:"version"`
+		Digest     string `yaml:"digest"`
+	}
+	// LockedCharts represents a slice of LockedChart objects
+	LockedCharts []LockedChart
+	// helmRepoIndex represents the parts of a Helm repository index file that
+	// are needed to resolve chart versions
+	helmRepoIndex struct {
+		Entries map[string][]helmRepoIndexEntry `yaml:"entries"`
+	}
+	// helmRepoIndexEntry represents a single chart version in a Helm
+	// repository index file
+	helmRepoIndexEntry struct {
+		Version string   `yaml:"version"`
+		Digest  string   `yaml:"digest"`
+		URLs    []string `yaml:"urls"`
+	}
+)
+
+// lockfileName is the name of the lockfile that is stored alongside the
+// Kruise config
+const lockfileName = "kruise.lock"
+
+// Lock resolves the Helm chart version constraints of the passed deployments
+// and pins the resolved versions and digests in the lockfile
+//
+// Charts that are already pinned are left alone unless the update flag is
+// passed. If no arguments are passed, every deployment is locked and entries
+// for charts that no longer exist in the config are dropped. Entries of charts
+// that can't be resolved are kept, and Kruise exits with an error once the
+// charts that could be resolved have been written.
+func Lock(fs *pflag.FlagSet, args []string) {
+	update, err := fs.GetBool("update")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	all := len(args) == 0
+	if all {
+		for _, dep := range GetDeployments() {
+			args = append(args, dep.Name)
+		}
+	}
+	charts := getPassedHelmCharts(args)
+	if update {
+		helmRepoUpdate(fs, chartRepositories(charts)...)
+	}
+	lock := Kfg.Lock.copy()
+	var locked LockedCharts
+	// the constraints each chart is configured with, and the charts that
+	// couldn't be resolved
+	configured := make(map[string][]string)
+	failed := make(map[string]bool)
+	for _, c := range charts {
+		configured[c.RepoName+"/"+c.ChartName] = append(configured[c.RepoName+"/"+c.ChartName], c.Version)
+		if l, ok := lock.find(c); ok && !update {
+			locked = append(locked, l)
+			continue
+		}
+		l, err := c.resolve()
+		if err != nil {
+			Logger.Errorf("Unable to lock %s/%s: %v", c.RepoName, c.ChartName, err)
+			failed[c.RepoName+"/"+c.ChartName] = true
+			continue
+		}
+		Logger.Infof("Locked %s/%s %q to %s", l.Repository, l.Chart, l.Constraint, l.Version)
+		locked = append(locked, l)
+	}
+	// entries of the locked charts whose constraint is no longer configured
+	// are dropped, along with every chart that no longer exists in the config
+	// when everything is locked
+	lock.drop(func(lc LockedChart) bool {
+		constraints, ok := configured[lc.Repository+"/"+lc.Chart]
+		if !ok {
+			return all
+		}
+		return !failed[lc.Repository+"/"+lc.Chart] && !contains(constraints, lc.Constraint)
+	})
+	for _, l := range locked {
+		lock.set(l)
+	}
+	if d {
+		out, err := lock.marshal()
+		if err != nil {
+			Logger.Fatal(err)
+		}
+		fmt.Printf("%s", out)
+	} else {
+		if err := lock.write(); err != nil {
+			Logger.Fatal(err)
+		}
+		Logger.Infof("Wrote lockfile: %s", lock.Path)
+	}
+	if len(failed) > 0 {
+		Logger.Fatalf("Unable to lock %d chart(s); their previous entries were kept", len(failed))
+	}
+}
+
+// getPassedHelmCharts gets all deduplicated HelmCharts given passed arguments
+func getPassedHelmCharts(args []string) HelmCharts {
+	var charts HelmCharts
+	for _, i := range getAllPassedInstallers(args) {
+		if c, ok := i.(HelmChart); ok {
+			charts = append(charts, c)
+		}
+	}
+	return charts
+}
+
+// chartRepositories is used to get the unique names of the Helm repositories
+// that the given HelmCharts are installed from
+func chartRepositories(charts HelmCharts) []string {
+	var repos []string
+	for _, c := range charts {
+		if c.ChartPath == "" && !contains(repos, c.RepoName) {
+			repos = append(repos, c.RepoName)
+		}
+	}
+	return repos
+}
+
+// lockfilePath is used to determine where the lockfile lives given the path to
+// the config file in use
+//
+// Remote config files store their lockfile in the current working directory.
+func lockfilePath(cfgFile string) string {
+	if cfgFile == "" || isURL(cfgFile) {
+		return lockfileName
+	}
+	return filepath.Join(filepath.Dir(cfgFile), lockfileName)
+}
+
+// loadLockfile is used to read in the lockfile at the given path
+//
+// A missing lockfile is not an error; an empty Lockfile is returned instead.
+func loadLockfile(path string) (*Lockfile, error) {
+	lock := &Lockfile{Path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lock, nil
+	}
+	if err != nil {
+		return lock, err
+	}
+	if err := yaml.Unmarshal(b, lock); err != nil {
+		return lock, fmt.Errorf("invalid lockfile %s: %w", path, err)
+	}
+	return lock, nil
+}
+
+// copy is used to copy a Lockfile so that it can be modified without touching
+// the lockfile loaded with the config
+func (l *Lockfile) copy() *Lockfile {
+	if l == nil {
+		return &Lockfile{Path: lockfileName}
+	}
+	cp := &Lockfile{Path: l.Path}
+	cp.Charts = append(cp.Charts, l.Charts...)
+	return cp
+}
+
+// find is used to find the pinned version of a HelmChart
+//
+// An entry only matches if it was resolved from the chart's current version
+// constraint. A chart can be locked for several constraints, since different
+// deployments can install it with different ones; if none of its entries
+// match, they are reported once as out of date and ignored.
+func (l *Lockfile) find(c HelmChart) (LockedChart, bool) {
+	if l == nil {
+		return LockedChart{}, false
+	}
+	var stale []string
+	for _, lc := range l.Charts {
+		if lc.Repository != c.RepoName || lc.Chart != c.ChartName {
+			continue
+		}
+		if lc.Constraint == c.Version {
+			return lc, true
+		}
+		stale = append(stale, fmt.Sprintf("%q", lc.Constraint))
+	}
+	if len(stale) == 0 {
+		return LockedChart{}, false
+	}
+	key := c.RepoName + "/" + c.ChartName + "@" + c.Version
+	if _, warned := l.warned.LoadOrStore(key, true); !warned {
+		Logger.Warnf("%s is out of date for %s/%s (locked %s, configured %q); run kruise lock to update it", l.Path, c.RepoName, c.ChartName, strings.Join(stale, ", "), c.Version)
+	}
+	return LockedChart{}, false
+}
+
+// set is used to add or replace a LockedChart in the Lockfile
+//
+// Entries are keyed on their repository, chart and version constraint, so
+// locking one constraint of a chart leaves its other constraints alone.
+func (l *Lockfile) set(lc LockedChart) {
+	for i, existing := range l.Charts {
+		if existing.Repository == lc.Repository && existing.Chart == lc.Chart && existing.Constraint == lc.Constraint {
+			l.Charts[i] = lc
+			return
+		}
+	}
+	l.Charts = append(l.Charts, lc)
+}
+
+// drop is used to remove the entries of the Lockfile that the given function
+// reports as stale
+func (l *Lockfile) drop(stale func(LockedChart) bool) {
+	var kept LockedCharts
+	for _, lc := range l.Charts {
+		if !stale(lc) {
+			kept = append(kept, lc)
+		}
+	}
+	l.Charts = kept
+}
+
+// marshal is used to serialize the Lockfile with its entries in a stable order
+func (l *Lockfile) marshal() ([]byte, error) {
+	sort.SliceStable(l.Charts, func(i, j int) bool {
+		a, b := l.Charts[i], l.Charts[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		if a.Chart != b.Chart {
+			return a.Chart < b.Chart
+		}
+		return a.Constraint < b.Constraint
+	})
+	return marshalYAML(l)
+}
+
+// write is used to write the Lockfile to disk
+func (l *Lockfile) write() error {
+	b, err := l.marshal()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.Path, b, 0644)
+}
+
+// version is used to determine the version passed to Helm for a HelmChart,
+// preferring the version pinned in the lockfile over the configured constraint
+func (c HelmChart) version() string {
+	if Kfg != nil {
+		if l, ok := Kfg.Lock.find(c); ok {
+			return l.Version
+		}
+	}
+	return c.Version
+}
+
+// verifyLock is used to ensure that the digest of a pinned HelmChart still
+// matches the digest published in the Helm repository index
+//
+// A chart that isn't pinned or a repository index that can't be read is not
+// considered an error.
+func (c HelmChart) verifyLock() error {
+	if Kfg == nil || c.ChartPath != "" {
+		return nil
+	}
+	l, ok := Kfg.Lock.find(c)
+	if !ok || l.Digest == "" {
+		return nil
+	}
+	idx, err := readHelmRepoIndex(c.RepoName)
+	if err != nil {
+		Logger.Debugf("Skipping digest verification for %s/%s: %v", c.RepoName, c.ChartName, err)
+		return nil
+	}
+	for _, e := range idx.Entries[c.ChartName] {
+		if e.Version == l.Version && e.Digest != l.Digest {
+			return fmt.Errorf("digest mismatch for %s/%s %s: locked %s but the repository has %s", c.RepoName, c.ChartName, l.Version, l.Digest, e.Digest)
+		}
+	}
+	return nil
+}
+
+// resolve is used to resolve the version constraint of a HelmChart against its
+// Helm repository index
+//
+// An empty version is treated as the latest stable version.
+func (c HelmChart) resolve() (LockedChart, error) {
+	idx, err := readHelmRepoIndex(c.RepoName)
+	if err != nil {
+		return LockedChart{}, err
+	}
+	e, err := idx.latest(c.ChartName, c.Version)
+	if err != nil {
+		return LockedChart{}, err
+	}
+	return LockedChart{
+		Repository: c.RepoName,
+		Chart:      c.ChartName,
+		Constraint: c.Version,
+		Version:    e.Version,
+		Digest:     e.Digest,
+	}, nil
+}
+
+// latest is used to find the highest version of a chart in the index that
+// satisfies the given constraint
+func (idx helmRepoIndex) latest(chart string, constraint string) (helmRepoIndexEntry, error) {
+	if constraint == "" {
+		constraint = "*"
+	}
+	cons, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return helmRepoIndexEntry{}, fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+	entries, ok := idx.Entries[chart]
+	if !ok {
+		return helmRepoIndexEntry{}, fmt.Errorf("chart %s not found in the repository index", chart)
+	}
+	var best helmRepoIndexEntry
+	var bestVersion *semver.Version
+	for _, e := range entries {
+		v, err := semver.NewVersion(e.Version)
+		if err != nil {
+			continue
+		}
+		if cons.Check(v) && (bestVersion == nil || v.GreaterThan(bestVersion)) {
+			best = e
+			bestVersion = v
+		}
+	}
+	if bestVersion == nil {
+		return helmRepoIndexEntry{}, fmt.Errorf("no version of %s satisfies %q", chart, constraint)
+	}
+	return best, nil
+}
+
+// readHelmRepoIndex is used to read the cached index of the given Helm
+// repository
+func readHelmRepoIndex(repo string) (helmRepoIndex, error) {
+	var idx helmRepoIndex
+	path := filepath.Join(helmRepositoryCache(), repo+"-index.yaml")
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return idx, fmt.Errorf("unable to read the index of the %s Helm repository (has it been added with --init?): %w", repo, err)
+	}
+	err = yaml.Unmarshal(b, &idx)
+	return idx, err
+}
+
+// helmRepositoryCache is used to determine where Helm caches repository
+// indexes, honoring the HELM_REPOSITORY_CACHE environment variable
+func helmRepositoryCache() string {
+	if c := os.Getenv("HELM_REPOSITORY_CACHE"); c != "" {
+		return c
+	}
+	return filepath.Join(helmCacheHome(), "repository")
+}
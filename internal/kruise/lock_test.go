@@ -0,0 +1,85 @@
+package kruise
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testIndex = helmRepoIndex{
+	Entries: map[string][]helmRepoIndexEntry{
+		"base": {
+			{Version: "1.15.0", Digest: "c"},
+			{Version: "1.14.3", Digest: "b"},
+			{Version: "1.14.1", Digest: "a"},
+			{Version: "1.16.0-beta.1", Digest: "d"},
+		},
+	},
+}
+
+func TestHelmRepoIndexLatest(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+	}{
+		{"", "1.15.0"},
+		{"1.14.1", "1.14.1"},
+		{"~1.14", "1.14.3"},
+		{">=1.14 <1.15", "1.14.3"},
+		{"^1", "1.15.0"},
+	}
+	for _, tt := range tests {
+		e, err := testIndex.latest("base", tt.constraint)
+		assert.NoError(t, err, tt.constraint)
+		assert.Equal(t, tt.version, e.Version, tt.constraint)
+	}
+	_, err := testIndex.latest("base", "~2")
+	assert.Error(t, err)
+	_, err = testIndex.latest("istiod", "")
+	assert.Error(t, err)
+}
+
+func TestLockfileFind(t *testing.T) {
+	InitializeLogger()
+	lock := &Lockfile{Path: lockfileName}
+	lock.set(LockedChart{Repository: "istio", Chart: "base", Constraint: "~1.14", Version: "1.14.1"})
+	lock.set(LockedChart{Repository: "istio", Chart: "base", Constraint: "~1.14", Version: "1.14.3"})
+	assert.Len(t, lock.Charts, 1)
+	l, ok := lock.find(HelmChart{RepoName: "istio", ChartName: "base", Version: "~1.14"})
+	assert.True(t, ok)
+	assert.Equal(t, "1.14.3", l.Version)
+	_, ok = lock.find(HelmChart{RepoName: "istio", ChartName: "base", Version: "~1.15"})
+	assert.False(t, ok)
+}
+
+func TestLockfileConstraints(t *testing.T) {
+	var buf bytes.Buffer
+	Logger = &Klogger{log.New(&buf)}
+	t.Cleanup(InitializeLogger)
+	lock := &Lockfile{Path: lockfileName}
+	lock.set(LockedChart{Repository: "istio", Chart: "base", Constraint: "~1.14", Version: "1.14.3"})
+	c := HelmChart{RepoName: "istio", ChartName: "base", Version: "~1.15"}
+	lock.find(c)
+	lock.find(c)
+	assert.Equal(t, 1, strings.Count(buf.String(), "out of date"))
+	lock.set(LockedChart{Repository: "istio", Chart: "base", Constraint: "~1.15", Version: "1.15.0"})
+	assert.Len(t, lock.Charts, 2, "each constraint of a chart is locked")
+	l, ok := lock.find(c)
+	assert.True(t, ok)
+	assert.Equal(t, "1.15.0", l.Version)
+	l, ok = lock.find(HelmChart{RepoName: "istio", ChartName: "base", Version: "~1.14"})
+	assert.True(t, ok)
+	assert.Equal(t, "1.14.3", l.Version)
+	lock.drop(func(lc LockedChart) bool { return lc.Constraint == "~1.14" })
+	assert.Equal(t, LockedCharts{{Repository: "istio", Chart: "base", Constraint: "~1.15", Version: "1.15.0"}}, lock.Charts)
+}
+
+func TestLockfilePath(t *testing.T) {
+	assert.Equal(t, "examples/kruise.lock", lockfilePath("examples/kruise.yaml"))
+	assert.Equal(t, lockfileName, lockfilePath("https://example.com/kruise.yaml"))
+	assert.Equal(t, lockfileName, lockfilePath(""))
+}
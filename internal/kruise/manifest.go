@@ -0,0 +1,339 @@
+package kruise
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/adrg/xdg"
+	"gopkg.in/yaml.v3"
+)
+
+// manifestTemplateData is the data templated manifests are rendered with
+type manifestTemplateData struct {
+	// Env holds the environment variables of the current process that the
+	// manifest lists in its env
+	Env map[string]string
+	// Namespace is the namespace the manifest is applied to
+	Namespace string
+	// Deployment is the name of the deployment the manifest belongs to
+	Deployment string
+	// Releases maps the chart names of the deployment to their release names
+	Releases map[string]string
+}
+
+const (
+	// sha256Pin separates a remote URL from the sha256 digest it is pinned to
+	sha256Pin = "#sha256="
+	// manifestLabel is the label Kruise adds to the resources of pruned
+	// manifests so that resources removed from them can be found again
+	manifestLabel = "kruise/manifest"
+)
+
+// invalidLabelChars matches the characters that aren't allowed in label values
+var invalidLabelChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// manifestFuncs are the functions available to templated manifests
+var manifestFuncs = template.FuncMap{
+	"default": func(d string, v string) string {
+		if v == "" {
+			return d
+		}
+		return v
+	},
+	"quote": strconv.Quote,
+}
+
+// forDeployment is used to record the deployment metadata that templated
+// manifests are rendered with
+//
+// Pruned manifests are identified by their deployment and namespace, so only
+// one manifest per namespace of a deployment may be pruned. Resources are only
+// ever pruned by the manifest that labelled them, so removing a pruned
+// manifest from the config leaves its resources behind.
+func (m KubectlManifests) forDeployment(d Deployment) KubectlManifests {
+	releases := make(map[string]string)
+	for _, c := range d.Helm.Charts {
+		name := c.ChartName
+		if name == "" {
+			name = c.ReleaseName
+		}
+		releases[name] = c.ReleaseName
+	}
+	pruned := make(map[string]bool)
+	for i := range m {
+		m[i].Deployment = d.Name
+		m[i].Releases = releases
+		if !m[i].Prune {
+			continue
+		}
+		if pruned[m[i].Namespace] {
+			Logger.Fatalf("Only one manifest per namespace can be pruned, but %s has more than one in %s", d.Name, m[i].Namespace)
+		}
+		pruned[m[i].Namespace] = true
+	}
+	return m
+}
+
+// stdin is used to determine whether the manifest has to be read by Kruise
+// and passed to Kubectl on stdin rather than by path
+func (m KubectlManifest) stdin() bool {
+	return m.Template || m.Prune
+}
+
+// pruneSelector is used to get the label selector that identifies the
+// resources of a pruned manifest
+func (m KubectlManifest) pruneSelector() string {
+	v := invalidLabelChars.ReplaceAllString(strings.ToLower(m.Deployment+"-"+m.Namespace), "-")
+	if len(v) > 63 {
+		v = v[:63]
+	}
+	return manifestLabel + "=" + strings.Trim(v, "._-")
+}
+
+// localPaths is used to replace the remote URLs of a manifest with the paths
+// of their cached downloads
+//
+// Remote URLs are left as-is during a dry run unless they need to be rendered.
+func (m KubectlManifest) localPaths(dry bool) []string {
+	var paths []string
+	for _, p := range m.Paths {
+		if !isURL(p) {
+			paths = append(paths, p)
+			continue
+		}
+		if dry && !m.stdin() {
+			u, _, _ := strings.Cut(p, sha256Pin)
+			paths = append(paths, u)
+			continue
+		}
+		lp, err := fetchRemoteFile(p)
+		if err != nil {
+			Logger.Fatal(err)
+		}
+		paths = append(paths, lp)
+	}
+	return paths
+}
+
+// execute is used to execute a Kubectl command for the manifest, passing
+// templated and pruned manifests on stdin once they are rendered
+func (m KubectlManifest) execute(out io.Writer, dry bool, args []string) error {
+	if !m.stdin() {
+		return kubectlExecute(out, dry, args)
+	}
+	rendered, err := m.render()
+	if err != nil {
+		return err
+	}
+	return NewCmd("kubectl").
+		WithArgs(args).
+		WithStdin(rendered).
+		WithDryRun(dry).
+		WithOutput(out).
+		Build().
+		Execute()
+}
+
+// render is used to render the paths of a manifest into a single
+// multi-document YAML stream
+//
+// Directories are rendered file by file in lexical order, skipping any file
+// that isn't YAML or JSON. Templates are only executed for templated manifests
+// and the resources of pruned manifests are labelled with their prune selector.
+func (m KubectlManifest) render() ([]byte, error) {
+	data := manifestTemplateData{
+		Env:        environ(m.Env),
+		Namespace:  m.Namespace,
+		Deployment: m.Deployment,
+		Releases:   m.Releases,
+	}
+	var buf bytes.Buffer
+	for _, p := range m.Paths {
+		err := filepath.WalkDir(p, func(f string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			if f != p && !contains([]string{".yaml", ".yml", ".json"}, filepath.Ext(f)) {
+				return nil
+			}
+			content, err := os.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			if m.Template {
+				t, err := template.New(f).Funcs(manifestFuncs).Option("missingkey=zero").Parse(string(content))
+				if err != nil {
+					return err
+				}
+				var out bytes.Buffer
+				if err := t.Execute(&out, data); err != nil {
+					return err
+				}
+				content = out.Bytes()
+			}
+			if m.Prune {
+				k, v, _ := strings.Cut(m.pruneSelector(), "=")
+				content, err = labelResources(content, k, v)
+				if err != nil {
+					return err
+				}
+			}
+			if buf.Len() > 0 {
+				buf.WriteString("---\n")
+			}
+			buf.Write(content)
+			if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+				buf.WriteString("\n")
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to render %s: %w", p, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// labelResources is used to add a label to every resource of a YAML or JSON
+// stream, including the items of lists
+func labelResources(content []byte, key string, val string) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	var docs []*yaml.Node
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		labelResource(doc.Content[0], key, val)
+		docs = append(docs, &doc)
+	}
+	var buf bytes.Buffer
+	for i, doc := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		out, err := marshalYAML(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
+
+// labelResource is used to add a label to a resource, recursing into the
+// items of lists
+func labelResource(n *yaml.Node, key string, val string) {
+	if n.Kind != yaml.MappingNode {
+		return
+	}
+	if items := mappingValue(n, "items"); items != nil && items.Kind == yaml.SequenceNode {
+		for _, item := range items.Content {
+			labelResource(item, key, val)
+		}
+		return
+	}
+	labels := mappingEntry(mappingEntry(n, "metadata"), "labels")
+	*mappingEntry(labels, key) = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: val}
+}
+
+// mappingEntry is used to get the value of a key of a YAML mapping, adding
+// the key as an empty mapping if it is missing or null
+func mappingEntry(n *yaml.Node, key string) *yaml.Node {
+	v := mappingValue(n, key)
+	if v == nil {
+		v = &yaml.Node{}
+		n.Content = append(n.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, v)
+	}
+	if v.Kind != yaml.MappingNode && (v.Kind == 0 || v.Tag == "!!null") {
+		*v = yaml.Node{Kind: yaml.MappingNode}
+	}
+	return v
+}
+
+// mappingValue is used to get the value of a key of a YAML mapping
+func mappingValue(n *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// environ is used to get the given environment variables of the current
+// process as a map, leaving out any that aren't set
+//
+// Only the variables a manifest asks for are exposed, since rendered manifests
+// are printed during a dry run and the rest of the environment may hold
+// credentials.
+func environ(keys []string) map[string]string {
+	env := make(map[string]string)
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(k); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// fetchRemoteFile is used to download a remote file into the Kruise cache and
+// return the path of the cached copy
+//
+// A URL may be pinned with a #sha256=<digest> suffix, in which case the
+// download must match the digest and a matching cached copy is reused without
+// fetching it again. Unpinned URLs are fetched on every run.
+func fetchRemoteFile(u string) (string, error) {
+	u, pin, pinned := strings.Cut(u, sha256Pin)
+	pin = strings.ToLower(pin)
+	base := path.Base(u)
+	if parsed, err := url.Parse(u); err == nil {
+		base = path.Base(parsed.Path)
+	}
+	dir := filepath.Join(xdg.CacheHome, "kruise", "remote")
+	var name string
+	if pinned {
+		name = filepath.Join(dir, pin+"-"+base)
+		if content, err := os.ReadFile(name); err == nil && sha256Hex(content) == pin {
+			Logger.Debugf("Using cached %s", u)
+			return name, nil
+		}
+	} else {
+		name = filepath.Join(dir, sha256Hex([]byte(u))[:16]+"-"+base)
+	}
+	Logger.Debugf("Fetching %s", u)
+	content, err := fetchConfigFromURL(u)
+	if err != nil {
+		return "", fmt.Errorf("unable to fetch %s: %w", u, err)
+	}
+	if sum := sha256Hex(content); pinned && sum != pin {
+		return "", fmt.Errorf("sha256 mismatch for %s: expected %s, got %s", u, pin, sum)
+	}
+	return name, writeFile(name, content, 0644)
+}
+
+// sha256Hex is used to get the hex encoded sha256 digest of the given content
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
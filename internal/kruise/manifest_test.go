@@ -0,0 +1,106 @@
+package kruise
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adrg/xdg"
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchRemoteFile(t *testing.T) {
+	InitializeLogger()
+	cache := xdg.CacheHome
+	xdg.CacheHome = t.TempDir()
+	defer func() { xdg.CacheHome = cache }()
+	content := []byte("kind: Namespace\n")
+	fetches := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(content)
+	}))
+	defer srv.Close()
+
+	pinned := srv.URL + "/ns.yaml" + sha256Pin + sha256Hex(content)
+	p, err := fetchRemoteFile(pinned)
+	require.NoError(t, err)
+	assert.Equal(t, "ns.yaml", filepath.Base(p)[65:])
+	_, err = fetchRemoteFile(pinned)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetches, "a pinned file should be served from the cache")
+
+	_, err = fetchRemoteFile(srv.URL + "/ns.yaml" + sha256Pin + sha256Hex([]byte("other")))
+	assert.ErrorContains(t, err, "sha256 mismatch")
+}
+
+func TestKubectlManifestRender(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("host: {{ .Releases.jaeger }}-query\nns: {{ .Namespace }}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.yaml"), []byte("host: {{ .Env.KRUISE_TEST_UNSET | default \"*\" | quote }}\nuser: {{ .Env.KRUISE_TEST_USER }}\ntoken: {{ .Env.KRUISE_TEST_TOKEN }}\n"), 0644))
+	t.Setenv("KRUISE_TEST_USER", "admin")
+	t.Setenv("KRUISE_TEST_TOKEN", "s3cret")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("{{ broken"), 0644))
+	m := newKubectlManifests([]latest.KubectlManifest{{Namespace: "tracing", Paths: []string{dir}, Template: true, Env: []string{"KRUISE_TEST_UNSET", "KRUISE_TEST_USER"}}}).
+		forDeployment(Deployment{Name: "jaeger", Helm: latest.HelmDeployment{Charts: []latest.HelmChart{{ChartName: "jaeger", ReleaseName: "tracing"}}}})
+	out, err := m[0].render()
+	require.NoError(t, err)
+	assert.Equal(t, "host: tracing-query\nns: tracing\n---\nhost: \"*\"\nuser: admin\ntoken: \n", string(out))
+}
+
+func TestLabelResources(t *testing.T) {
+	in := `kind: ConfigMap
+metadata:
+  name: a
+  labels:
+---
+kind: List
+items:
+  - kind: Service
+    metadata:
+      name: b
+      labels:
+        app: b
+`
+	out, err := labelResources([]byte(in), manifestLabel, "obs-tracing")
+	require.NoError(t, err)
+	assert.Equal(t, `kind: ConfigMap
+metadata:
+  name: a
+  labels:
+    kruise/manifest: obs-tracing
+---
+kind: List
+items:
+  - kind: Service
+    metadata:
+      name: b
+      labels:
+        app: b
+        kruise/manifest: obs-tracing
+`, string(out))
+	m := KubectlManifest{Deployment: "Obs Stack", KubectlManifest: latest.KubectlManifest{Namespace: "tracing", Prune: true, ServerSide: true}}
+	assert.Equal(t, "kruise/manifest=obs-stack-tracing", m.pruneSelector())
+	assert.Equal(t, []string{"apply", "--namespace", "tracing", "--server-side", "--field-manager", "kruise", "--prune", "--selector", "kruise/manifest=obs-stack-tracing", "-f", "-"}, m.installArgs(nil))
+}
+
+func TestKubectlManifestHash(t *testing.T) {
+	manifest := func(m latest.KubectlManifest, dep string) *KubectlManifest {
+		return &newKubectlManifests([]latest.KubectlManifest{m}).forDeployment(Deployment{Name: dep})[0]
+	}
+	plain := latest.KubectlManifest{Namespace: "tracing", Paths: []string{"vs.yaml"}}
+	templated := latest.KubectlManifest{Namespace: "tracing", Paths: []string{"vs.yaml"}, Template: true}
+	assert.Equal(t, manifest(plain, "jaeger").hash(), manifest(plain, "kiali").hash(), "plain manifests are shared between deployments")
+	assert.NotEqual(t, manifest(plain, "jaeger").hash(), manifest(latest.KubectlManifest{Namespace: "istio", Paths: plain.Paths}, "jaeger").hash())
+	assert.NotEqual(t, manifest(plain, "jaeger").hash(), manifest(templated, "jaeger").hash())
+	assert.NotEqual(t, manifest(templated, "jaeger").hash(), manifest(templated, "kiali").hash())
+	pruned := latest.KubectlManifest{Namespace: "tracing", Paths: []string{"vs.yaml"}, Prune: true}
+	assert.NotEqual(t, manifest(plain, "jaeger").hash(), manifest(pruned, "jaeger").hash())
+	assert.NotEqual(t, manifest(pruned, "jaeger").hash(), manifest(pruned, "kiali").hash())
+	assert.NotEqual(t, manifest(plain, "jaeger").hash(), manifest(latest.KubectlManifest{Namespace: "tracing", Paths: plain.Paths, ServerSide: true}, "jaeger").hash())
+	assert.NotEqual(t, manifest(latest.KubectlManifest{Paths: []string{"a", "b"}}, "").hash(), manifest(latest.KubectlManifest{Paths: []string{"ab"}}, "").hash())
+}
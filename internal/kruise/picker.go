@@ -0,0 +1,263 @@
+package kruise
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+type (
+	// pickerModel is the bubbletea model of the interactive deployment picker
+	//
+	// Choices are filtered with a fuzzy match on their names, aliases and
+	// descriptions. Only deployments are selected; a profile is shown as
+	// picked when all of its deployments are, and picking it picks them.
+	pickerModel struct {
+		filter    textinput.Model
+		choices   []pickerChoice
+		selected  map[string]bool
+		visible   []int
+		cursor    int
+		done      bool
+		cancelled bool
+	}
+
+	// pickerChoice represents a deployment or profile that can be picked
+	pickerChoice struct {
+		name    string
+		aliases []string
+		desc    string
+		items   []string
+		profile bool
+	}
+)
+
+var (
+	cursorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("6")).Bold(true)
+	profileStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
+)
+
+// CanPick is used to determine whether deployments can be picked interactively,
+// which needs a terminal and prompting to be enabled
+func CanPick(fs *pflag.FlagSet) bool {
+	return !nonInteractive(fs) && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// PickDeployments is used to let the user pick the deployments to deploy or
+// delete, depending on the given command, from every deployment and profile in
+// the config and confirm them
+func PickDeployments(fs *pflag.FlagSet, command string) []string {
+	if !CanPick(fs) {
+		Logger.Fatalf("Unable to pick deployments to %s without a terminal; pass them as arguments instead", command)
+	}
+	m := newPickerModel(pickerChoices(command))
+	final, err := tea.NewProgram(m).Run()
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	m = final.(pickerModel)
+	picked := m.picked()
+	if m.cancelled || len(picked) == 0 {
+		Logger.Fatalf("No deployments were picked to %s", command)
+	}
+	if !confirmPrompt(fs, fmt.Sprintf("%s%s %s?", strings.ToUpper(command[:1]), command[1:], strings.Join(picked, ", "))) {
+		Logger.Fatalf("Cancelled the %s", command)
+	}
+	return picked
+}
+
+// pickerChoices is used to get a choice for each profile and deployment in the
+// config, with the descriptions for the given command
+func pickerChoices(command string) []pickerChoice {
+	desc := func(d latest.DeploymentDesc) string {
+		if command == "delete" {
+			return d.Delete
+		}
+		return d.Deploy
+	}
+	var choices []pickerChoice
+	for _, p := range GetDeployProfiles() {
+		// items may be aliases or other profiles, but deployments are picked by
+		// name
+		choices = append(choices, pickerChoice{name: p.Name, aliases: p.Aliases, desc: desc(p.Description), items: p.deployments(), profile: true})
+	}
+	for _, d := range GetDeployments() {
+		choices = append(choices, pickerChoice{name: d.Name, aliases: d.Aliases, desc: desc(d.Description)})
+	}
+	return choices
+}
+
+// newPickerModel is used to create a pickerModel for the given choices
+func newPickerModel(choices []pickerChoice) pickerModel {
+	f := textinput.New()
+	f.Placeholder = "type to filter"
+	f.Prompt = "> "
+	f.Focus()
+	m := pickerModel{filter: f, choices: choices, selected: make(map[string]bool)}
+	m.refilter()
+	return m
+}
+
+// Init is used to start the cursor of the filter blinking
+func (m pickerModel) Init() tea.Cmd {
+	return textinput.Blink
+}
+
+// Update is used to move the cursor, toggle choices and filter them
+//
+// Space or tab toggles the choice under the cursor, enter confirms and escape
+// cancels; anything else is typed into the filter.
+func (m pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.Type {
+		case tea.KeyCtrlC, tea.KeyEsc:
+			m.cancelled = true
+			return m, tea.Quit
+		case tea.KeyEnter:
+			m.done = true
+			return m, tea.Quit
+		case tea.KeyUp, tea.KeyCtrlP:
+			if m.cursor > 0 {
+				m.cursor--
+			}
+			return m, nil
+		case tea.KeyDown, tea.KeyCtrlN:
+			if m.cursor < len(m.visible)-1 {
+				m.cursor++
+			}
+			return m, nil
+		case tea.KeySpace, tea.KeyTab:
+			if len(m.visible) > 0 {
+				m.toggle(m.choices[m.visible[m.cursor]])
+			}
+			return m, nil
+		}
+	}
+	var cmd tea.Cmd
+	m.filter, cmd = m.filter.Update(msg)
+	m.refilter()
+	return m, cmd
+}
+
+// View is used to render the filter followed by the choices that match it
+func (m pickerModel) View() string {
+	if m.done || m.cancelled {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(m.filter.View() + "\n\n")
+	for n, i := range m.visible {
+		c := m.choices[i]
+		pointer := "  "
+		if n == m.cursor {
+			pointer = cursorStyle.Render("> ")
+		}
+		check := "[ ]"
+		switch n := m.count(c); {
+		case n > 0 && n == len(c.items):
+			check = "[x]"
+		case n > 0:
+			check = "[-]"
+		case !c.profile && m.selected[c.name]:
+			check = "[x]"
+		}
+		name := c.name
+		if len(c.aliases) > 0 {
+			name += " (" + strings.Join(c.aliases, ", ") + ")"
+		}
+		if c.profile {
+			name = profileStyle.Render(name + " [profile]")
+		}
+		b.WriteString(fmt.Sprintf("%s%s %s", pointer, check, name))
+		if c.desc != "" {
+			b.WriteString("  " + faintStyle.Render(c.desc))
+		}
+		b.WriteString("\n")
+	}
+	if len(m.visible) == 0 {
+		b.WriteString(faintStyle.Render("  no matches") + "\n")
+	}
+	b.WriteString("\n" + faintStyle.Render("space: toggle • enter: confirm • esc: cancel") + "\n")
+	return b.String()
+}
+
+// toggle is used to select or deselect a deployment, or every deployment of
+// a profile, which are selected unless they all already are
+func (m *pickerModel) toggle(c pickerChoice) {
+	if !c.profile {
+		m.selected[c.name] = !m.selected[c.name]
+		return
+	}
+	on := m.count(c) < len(c.items)
+	for _, item := range c.items {
+		m.selected[item] = on
+	}
+}
+
+// count is used to get how many deployments of a profile are selected
+func (m pickerModel) count(c pickerChoice) int {
+	n := 0
+	for _, item := range c.items {
+		if m.selected[item] {
+			n++
+		}
+	}
+	return n
+}
+
+// refilter is used to update the visible choices after the filter changes
+func (m *pickerModel) refilter() {
+	m.visible = nil
+	for i, c := range m.choices {
+		for _, text := range append([]string{c.name, c.desc}, c.aliases...) {
+			if fuzzyMatch(m.filter.Value(), text) {
+				m.visible = append(m.visible, i)
+				break
+			}
+		}
+	}
+	if m.cursor >= len(m.visible) {
+		m.cursor = len(m.visible) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// picked is used to get the names of the picked deployments in the order they
+// are configured
+//
+// Profiles aren't returned themselves since picking one picks its deployments.
+func (m pickerModel) picked() []string {
+	var picked []string
+	for _, c := range m.choices {
+		if !c.profile && m.selected[c.name] {
+			picked = append(picked, c.name)
+		}
+	}
+	return picked
+}
+
+// fuzzyMatch is used to determine whether the characters of the query appear
+// in the text in order, ignoring case
+func fuzzyMatch(query string, text string) bool {
+	t := []rune(strings.ToLower(text))
+	i := 0
+	for _, q := range strings.ToLower(strings.TrimSpace(query)) {
+		for i < len(t) && t[i] != q {
+			i++
+		}
+		if i == len(t) {
+			return false
+		}
+		i++
+	}
+	return true
+}
@@ -0,0 +1,66 @@
+package kruise
+
+import (
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPickerModel(t *testing.T) {
+	m := newPickerModel([]pickerChoice{
+		{name: "observability", aliases: []string{"o11y"}, items: []string{"jaeger", "loki"}, profile: true},
+		{name: "istio", desc: "Istio service mesh"},
+		{name: "jaeger", desc: "Jaeger tracing"},
+		{name: "loki", desc: "Loki logging"},
+	})
+	press := func(msgs ...tea.KeyMsg) {
+		for _, msg := range msgs {
+			next, _ := m.Update(msg)
+			m = next.(pickerModel)
+		}
+	}
+	// picking a profile picks its deployments
+	press(tea.KeyMsg{Type: tea.KeySpace})
+	assert.Equal(t, []string{"jaeger", "loki"}, m.picked())
+	assert.Contains(t, m.View(), "[x] ")
+	// a profile with only some of its deployments picked is picked again in
+	// full
+	m.selected["loki"] = false
+	assert.Contains(t, m.View(), "[-] ")
+	press(tea.KeyMsg{Type: tea.KeySpace})
+	assert.Equal(t, []string{"jaeger", "loki"}, m.picked())
+
+	press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("mesh")})
+	assert.Equal(t, []int{1}, m.visible)
+	assert.Contains(t, m.View(), "Istio service mesh")
+	press(tea.KeyMsg{Type: tea.KeyTab}, tea.KeyMsg{Type: tea.KeyEnter})
+	assert.True(t, m.done)
+	assert.Equal(t, []string{"istio", "jaeger", "loki"}, m.picked())
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	assert.True(t, fuzzyMatch("prmop", "prometheus-operator"))
+	assert.True(t, fuzzyMatch("", "istio"))
+	assert.False(t, fuzzyMatch("lok", "jaeger"))
+}
+
+func TestProfileDeployments(t *testing.T) {
+	old := Kfg
+	Kfg = &Konfig{}
+	Kfg.Manifest.Deploy.Deployments = []latest.Deployment{
+		{Name: "istio"},
+		{Name: "jaeger"},
+		{Name: "prometheus-operator", Aliases: []string{"prom-op"}},
+	}
+	Kfg.Manifest.Deploy.Profiles = []latest.Profile{
+		{Name: "metrics", Items: []string{"istio", "prom-op"}},
+		{Name: "observability", Items: []string{"metrics", "jaeger", "observability"}},
+	}
+	t.Cleanup(func() { Kfg = old })
+	p, ok := argIsProfile("observability")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"istio", "prometheus-operator", "jaeger"}, p.deployments())
+	assert.Equal(t, []string{"jaeger", "istio", "prometheus-operator"}, deduplicateArgs([]string{"jaeger", "observability"}))
+}
@@ -0,0 +1,130 @@
+package kruise
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/spf13/pflag"
+)
+
+type (
+	// batchProgress keeps track of how many Installers of a priority batch are
+	// queued, running and done
+	batchProgress struct {
+		mu       sync.Mutex
+		priority int
+		queued   int
+		running  int
+		done     int
+		quiet    bool
+	}
+
+	// job is an Installer handed to a worker along with its progressUI row
+	job struct {
+		installer Installer
+		row       int
+	}
+)
+
+// runc is used to invoke the given function for each of the given Installers
+// with a pool of workers, one priority batch at a time
+//
+// Batches are run in ascending order of priority, or descending order if desc
+// is set, and each batch finishes before the next one starts.
+func runc(fs *pflag.FlagSet, desc bool, run func(Installer, *pflag.FlagSet, io.Writer) error, installers ...Installer) {
+	workers := maxParallel(fs)
+	if workers > 0 {
+		Logger.Debugf("Running with up to %d workers", workers)
+	}
+	m := priorityMap(installers...)
+	var keys []int
+	for k := range m {
+		keys = append(keys, k)
+	}
+	if desc {
+		sort.Sort(sort.Reverse(sort.IntSlice(keys)))
+	} else {
+		sort.Ints(keys)
+	}
+	ui := newProgressUI(fs, keys, m)
+	row := 0
+	for _, k := range keys {
+		if ui == nil {
+			Logger.Infof("Priority %d waitgroup starting", k)
+		}
+		runBatch(fs, ui, row, k, workers, run, m[k])
+		row += len(m[k])
+		Logger.Debugf("Priority %d waitgroup stopping", k)
+	}
+	ui.stop()
+	Logger.Debug("Finished running concurrently")
+}
+
+// runBatch is used to invoke the given function for each Installer of a batch
+// with at most the given number of workers, or all at once if it is 0
+//
+// Progress is shown on the given progressUI, starting at the given row, with
+// everything an Installer prints written to its row, or logged if there isn't
+// one.
+func runBatch(fs *pflag.FlagSet, ui *progressUI, row int, priority int, workers int, run func(Installer, *pflag.FlagSet, io.Writer) error, batch Installers) {
+	if workers <= 0 || workers > len(batch) {
+		workers = len(batch)
+	}
+	p := &batchProgress{priority: priority, queued: len(batch), quiet: ui != nil}
+	jobs := make(chan job)
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				p.update(-1, 1, 0)
+				ui.start(j.row)
+				err := run(j.installer, fs, ui.writer(j.row))
+				if ui == nil && err != nil {
+					Logger.Error(err)
+				}
+				ui.finish(j.row, err)
+				p.update(0, -1, 1)
+			}
+		}()
+	}
+	for n, i := range batch {
+		jobs <- job{installer: i, row: row + n}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// update is used to adjust the counts of a batch and report them
+func (p *batchProgress) update(queued int, running int, done int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.queued += queued
+	p.running += running
+	p.done += done
+	if p.quiet {
+		return
+	}
+	Logger.Infof("Priority %d: %d queued, %d running, %d done", p.priority, p.queued, p.running, p.done)
+}
+
+// maxParallel is used to get the maximum number of Installers that may run at
+// once from the max-parallel flag, falling back to the maxParallel of the
+// config
+//
+// 0 means there is no limit, so every Installer of a batch runs at once.
+func maxParallel(fs *pflag.FlagSet) int {
+	n, err := fs.GetInt("max-parallel")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if n <= 0 && Kfg != nil {
+		n = Kfg.Manifest.Deploy.MaxParallel
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n
+}
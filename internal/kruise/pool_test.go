@@ -0,0 +1,67 @@
+package kruise
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeInstaller records how many fakeInstallers are installing at once
+type fakeInstaller struct {
+	priority int
+	mu       *sync.Mutex
+	running  *int
+	peak     *int
+	order    *[]int
+}
+
+func (f fakeInstaller) Install(fs *pflag.FlagSet, out io.Writer) error {
+	f.mu.Lock()
+	*f.running++
+	if *f.running > *f.peak {
+		*f.peak = *f.running
+	}
+	*f.order = append(*f.order, f.priority)
+	f.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	f.mu.Lock()
+	*f.running--
+	f.mu.Unlock()
+	return nil
+}
+
+func (f fakeInstaller) Uninstall(fs *pflag.FlagSet, out io.Writer) error { return f.Install(fs, out) }
+func (f fakeInstaller) GetPriority() int                                 { return f.priority }
+func (f fakeInstaller) IsInit() bool                                     { return false }
+
+func TestRunc(t *testing.T) {
+	InitializeLogger()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Int("max-parallel", 2, "")
+	fs.Bool("dry-run", false, "")
+	var mu sync.Mutex
+	var running, peak int
+	var order []int
+	var installers Installers
+	for i := 0; i < 6; i++ {
+		installers = append(installers, fakeInstaller{priority: i % 2, mu: &mu, running: &running, peak: &peak, order: &order})
+	}
+	runc(fs, false, install, installers...)
+	assert.Equal(t, 2, peak)
+	assert.Equal(t, []int{0, 0, 0, 1, 1, 1}, order)
+
+	order = nil
+	runc(fs, true, uninstall, installers...)
+	assert.Equal(t, []int{1, 1, 1, 0, 0, 0}, order)
+
+	// without a limit, every Installer of a batch runs at once
+	peak = 0
+	require.NoError(t, fs.Set("max-parallel", "0"))
+	runc(fs, false, install, installers...)
+	assert.Equal(t, 3, peak)
+}
@@ -16,3 +16,33 @@ type (
 func newProfile(prof latest.Profile) Profile {
 	return Profile(prof)
 }
+
+// deployments is used to get the names of the deployments of the Profile in
+// the order they appear in its items
+//
+// An item may name another profile, in which case its deployments are included
+// in its place; a profile that includes itself is only expanded once.
+func (p Profile) deployments() []string {
+	return p.expand(map[string]bool{})
+}
+
+// expand is used to get the names of the deployments of the Profile, skipping
+// the profiles that have already been expanded
+func (p Profile) expand(seen map[string]bool) []string {
+	seen[p.Name] = true
+	var names []string
+	for _, item := range p.Items {
+		var items []string
+		if d, ok := argIsDeployment(item); ok {
+			items = []string{d.Name}
+		} else if nested, ok := argIsProfile(item); ok && !seen[nested.Name] {
+			items = nested.expand(seen)
+		}
+		for _, name := range items {
+			if !contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
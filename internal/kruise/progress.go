@@ -0,0 +1,308 @@
+package kruise
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+)
+
+type (
+	// progressUI is an interactive view of concurrent installers, with a row
+	// per installer grouped by priority batch
+	//
+	// Each installer writes to its own row, and anything else Kruise prints
+	// while it runs is held back until the view is stopped.
+	progressUI struct {
+		program *tea.Program
+		done    chan tea.Model
+		mu      sync.Mutex
+		rows    []progressRow
+		stray   []string
+		cleanup func()
+	}
+
+	// rowWriter is an io.Writer that sends each line written to it to a row of
+	// a progressUI
+	rowWriter struct {
+		ui  *progressUI
+		row int
+	}
+
+	// progressModel is the bubbletea model of the progressUI
+	progressModel struct {
+		spinner  spinner.Model
+		rows     []progressRow
+		finished bool
+	}
+
+	// progressRow represents the progress of a single installer
+	progressRow struct {
+		name     string
+		priority int
+		status   string
+		start    time.Time
+		end      time.Time
+		output   []string
+	}
+
+	// rowStartedMsg is sent when an installer starts running
+	rowStartedMsg struct {
+		row int
+		at  time.Time
+	}
+
+	// rowFinishedMsg is sent when an installer is done, with the error it
+	// failed with if any
+	rowFinishedMsg struct {
+		row int
+		at  time.Time
+		err error
+	}
+
+	// rowOutputMsg is sent for each line printed by an installer
+	rowOutputMsg struct {
+		row  int
+		line string
+	}
+
+	// progressDoneMsg is sent once every installer is done
+	progressDoneMsg struct{}
+)
+
+const (
+	statusQueued  = "queued"
+	statusRunning = "running"
+	statusDone    = "done"
+	statusFailed  = "failed"
+)
+
+var (
+	doneStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	failedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	faintStyle  = lipgloss.NewStyle().Faint(true)
+	batchStyle  = lipgloss.NewStyle().Bold(true)
+)
+
+// newProgressUI is used to start a progressUI for the given priority batches
+// if stdout is a terminal and the run isn't a dry run
+//
+// A nil progressUI is returned otherwise, which plain log lines are used in
+// place of.
+func newProgressUI(fs *pflag.FlagSet, keys []int, m map[int]Installers) *progressUI {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if d || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil
+	}
+	u := &progressUI{done: make(chan tea.Model, 1)}
+	for _, k := range keys {
+		for _, i := range m[k] {
+			u.rows = append(u.rows, progressRow{name: installerName(i), priority: k, status: statusQueued})
+		}
+	}
+	model := progressModel{spinner: spinner.New(spinner.WithSpinner(spinner.Dot)), rows: append([]progressRow{}, u.rows...)}
+	u.program = tea.NewProgram(model, tea.WithOutput(os.Stdout), tea.WithInput(strings.NewReader("")))
+	// the view is stopped however Kruise exits, so that a fatal error is
+	// printed to the terminal rather than the view
+	u.cleanup = atExit(u.close)
+	go func() {
+		final, err := u.program.Run()
+		u.done <- final
+		if m, ok := final.(progressModel); ok && err == nil && !m.finished {
+			// interrupted, which would otherwise have stopped Kruise right away
+			exit(130)
+		}
+	}()
+	output = u
+	setLogOutput(u)
+	return u
+}
+
+// start is used to mark the given row as running
+func (u *progressUI) start(row int) {
+	if u == nil {
+		return
+	}
+	u.program.Send(rowStartedMsg{row: row, at: time.Now()})
+}
+
+// finish is used to mark the given row as done, or failed if an error is
+// given
+func (u *progressUI) finish(row int, err error) {
+	if u == nil {
+		return
+	}
+	u.program.Send(rowFinishedMsg{row: row, at: time.Now(), err: err})
+}
+
+// writer is used to get the io.Writer of the given row, which is nil if there
+// is no progressUI so that output is written to stdout
+func (u *progressUI) writer(row int) io.Writer {
+	if u == nil {
+		return nil
+	}
+	return rowWriter{ui: u, row: row}
+}
+
+// stop is used to stop the progressUI once every installer is done
+func (u *progressUI) stop() {
+	if u == nil {
+		return
+	}
+	u.cleanup()
+}
+
+// close is used to stop the progressUI and print the output of any installer
+// that failed, followed by anything printed outside of an installer
+func (u *progressUI) close() {
+	u.program.Send(progressDoneMsg{})
+	final := <-u.done
+	output = nil
+	setLogOutput(os.Stderr)
+	if m, ok := final.(progressModel); ok {
+		u.rows = m.rows
+	}
+	for _, r := range u.rows {
+		if r.status == statusFailed {
+			fmt.Fprintf(os.Stderr, "\n%s output:\n%s\n", r.name, strings.Join(r.output, "\n"))
+		}
+	}
+	for _, l := range u.stray {
+		fmt.Fprintln(os.Stderr, l)
+	}
+}
+
+// Write is used to hold on to anything printed outside of an installer until
+// the progressUI is stopped
+func (u *progressUI) Write(p []byte) (int, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, line := range lines(p) {
+		u.stray = append(u.stray, line)
+	}
+	return len(p), nil
+}
+
+// Write is used to send each line written to the row of the rowWriter
+func (w rowWriter) Write(p []byte) (int, error) {
+	for _, line := range lines(p) {
+		w.ui.program.Send(rowOutputMsg{row: w.row, line: line})
+	}
+	return len(p), nil
+}
+
+// Init is used to start the spinner
+func (m progressModel) Init() tea.Cmd {
+	return m.spinner.Tick
+}
+
+// Update is used to apply progress messages to the model
+func (m progressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case rowStartedMsg:
+		m.rows[msg.row].status = statusRunning
+		m.rows[msg.row].start = msg.at
+	case rowFinishedMsg:
+		r := &m.rows[msg.row]
+		r.status = statusDone
+		if msg.err != nil {
+			r.status = statusFailed
+			r.output = append(r.output, lines([]byte(msg.err.Error()))...)
+		}
+		r.end = msg.at
+	case rowOutputMsg:
+		m.rows[msg.row].output = append(m.rows[msg.row].output, msg.line)
+	case progressDoneMsg:
+		m.finished = true
+		return m, tea.Quit
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+	return m, nil
+}
+
+// View is used to render a row per installer grouped by priority batch
+func (m progressModel) View() string {
+	var b strings.Builder
+	width := 0
+	for _, r := range m.rows {
+		if len(r.name) > width {
+			width = len(r.name)
+		}
+	}
+	for i, r := range m.rows {
+		if i == 0 || m.rows[i-1].priority != r.priority {
+			b.WriteString(batchStyle.Render(fmt.Sprintf("Priority %d", r.priority)) + "\n")
+		}
+		var icon string
+		switch r.status {
+		case statusQueued:
+			icon = faintStyle.Render("•")
+		case statusRunning:
+			icon = m.spinner.View()
+		case statusDone:
+			icon = doneStyle.Render("✓")
+		case statusFailed:
+			icon = failedStyle.Render("✗")
+		}
+		line := fmt.Sprintf("  %s %-*s  %-7s  %6s", icon, width, r.name, r.status, r.elapsed())
+		if len(r.output) > 0 && r.status != statusDone {
+			line += "  " + faintStyle.Render(truncate(r.output[len(r.output)-1], 80))
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// elapsed is used to get how long the installer has been running for, or how
+// long it took once it's done
+func (r progressRow) elapsed() string {
+	switch {
+	case r.start.IsZero():
+		return ""
+	case r.end.IsZero():
+		return time.Since(r.start).Round(100 * time.Millisecond).String()
+	default:
+		return r.end.Sub(r.start).Round(100 * time.Millisecond).String()
+	}
+}
+
+// installerName is used to get a short description of an Installer
+func installerName(i Installer) string {
+	typ, name, _ := describe(i)
+	return strings.TrimSpace(typ + " " + name)
+}
+
+// lines is used to split what was written to an io.Writer into its non-blank
+// lines
+func lines(p []byte) []string {
+	var l []string
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if strings.TrimSpace(line) != "" {
+			l = append(l, line)
+		}
+	}
+	return l
+}
+
+// truncate is used to shorten a line to at most n runes
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
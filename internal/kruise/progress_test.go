@@ -0,0 +1,48 @@
+package kruise
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressModelUpdate(t *testing.T) {
+	m := progressModel{
+		spinner: spinner.New(),
+		rows: []progressRow{
+			{name: "chart istio-base", priority: 0, status: statusQueued},
+			{name: "chart istiod", priority: 1, status: statusQueued},
+		},
+	}
+	start := time.Now()
+	msgs := []interface{}{
+		rowStartedMsg{row: 0, at: start},
+		rowOutputMsg{row: 0, line: "Error: INSTALLATION FAILED: timed out waiting for the condition"},
+		rowFinishedMsg{row: 0, at: start.Add(2 * time.Second), err: errors.New("exit status 1")},
+		rowStartedMsg{row: 1, at: start},
+		rowOutputMsg{row: 1, line: "Release \"istiod\" has been upgraded."},
+	}
+	for _, msg := range msgs {
+		next, _ := m.Update(msg)
+		m = next.(progressModel)
+	}
+	assert.Equal(t, statusFailed, m.rows[0].status)
+	assert.Equal(t, []string{"Error: INSTALLATION FAILED: timed out waiting for the condition", "exit status 1"}, m.rows[0].output)
+	assert.Equal(t, "2s", m.rows[0].elapsed())
+	assert.Equal(t, statusRunning, m.rows[1].status)
+	v := m.View()
+	assert.Contains(t, v, "Priority 0")
+	assert.Contains(t, v, "Priority 1")
+	assert.Contains(t, v, `Release "istiod" has been upgraded.`)
+
+	next, _ := m.Update(progressDoneMsg{})
+	assert.True(t, next.(progressModel).finished)
+}
+
+func TestLines(t *testing.T) {
+	assert.Equal(t, []string{"one", "  two"}, lines([]byte("one\n\n  two\n")))
+	assert.Empty(t, lines([]byte("\n")))
+}
@@ -4,20 +4,45 @@ import (
 	"github.com/charmbracelet/bubbles/textinput"
 	"github.com/cqroot/prompt"
 	"github.com/cqroot/prompt/input"
+	"github.com/spf13/pflag"
 )
 
-func normalInputPrompt(p string) string {
-	return inputPrompt(p, input.EchoNormal)
+func normalInputPrompt(fs *pflag.FlagSet, p string) string {
+	return inputPrompt(fs, p, input.EchoNormal)
 }
 
-func sensitiveInputPrompt(p string) string {
-	return inputPrompt(p, input.EchoPassword)
+func sensitiveInputPrompt(fs *pflag.FlagSet, p string) string {
+	return inputPrompt(fs, p, input.EchoPassword)
 }
 
-func inputPrompt(p string, mode textinput.EchoMode) string {
+func inputPrompt(fs *pflag.FlagSet, p string, mode textinput.EchoMode) string {
+	if nonInteractive(fs) {
+		Logger.Fatalf("Unable to prompt in non-interactive mode: %s", p)
+	}
 	val, err := prompt.New().Ask(p).Input("", input.WithEchoMode(mode))
 	if err != nil {
 		Logger.Fatal(err)
 	}
 	return val
 }
+
+// confirmPrompt is used to ask the user a yes or no question, defaulting to no
+func confirmPrompt(fs *pflag.FlagSet, p string) bool {
+	if nonInteractive(fs) {
+		Logger.Fatalf("Unable to prompt in non-interactive mode: %s", p)
+	}
+	val, err := prompt.New().Ask(p).Choose([]string{"No", "Yes"})
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	return val == "Yes"
+}
+
+// nonInteractive is used to determine whether prompting has been disabled
+func nonInteractive(fs *pflag.FlagSet) bool {
+	n, err := fs.GetBool("non-interactive")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	return n
+}
@@ -0,0 +1,295 @@
+package kruise
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// SecretProvider represents a secret manager that sensitive values can be
+	// referenced from with a provider://path#key reference
+	SecretProvider interface {
+		// Get returns the value of the given key of the secret at the given
+		// path; the key may be empty for secrets that hold a single value
+		Get(path string, key string) (string, error)
+	}
+
+	// secretFetcher is implemented by SecretProviders that read every key of
+	// a secret at once, so that a secret is only fetched once however many of
+	// its keys are referenced
+	secretFetcher interface {
+		SecretProvider
+		// fetch returns the whole secret at the given path
+		fetch(path string) ([]byte, error)
+		// pick returns the value of the given key of a fetched secret
+		pick(secret []byte, key string) (string, error)
+	}
+
+	// secretRefCache keeps track of the secrets fetched from secret providers
+	// during a run so that each one is only fetched once
+	//
+	// Secrets are cached by path for providers that are secretFetchers and by
+	// reference otherwise. Each entry has its own lock so that fetching one
+	// secret doesn't hold up resolving any other.
+	secretRefCache struct {
+		mu      sync.Mutex
+		entries map[string]*secretRefEntry
+	}
+
+	// secretRefEntry represents a secret that has been or is being fetched
+	secretRefEntry struct {
+		mu     sync.Mutex
+		done   bool
+		secret []byte
+	}
+
+	// fileSecretProvider is a SecretProvider for a local YAML or JSON file of
+	// keys and values that is encrypted with SOPS or age
+	fileSecretProvider struct{}
+
+	// onePasswordSecretProvider is a SecretProvider for 1Password that uses
+	// the op CLI
+	onePasswordSecretProvider struct{}
+
+	// awsSecretsManagerSecretProvider is a SecretProvider for AWS Secrets
+	// Manager that uses the aws CLI
+	awsSecretsManagerSecretProvider struct{}
+)
+
+var (
+	// secretProviders are the SecretProviders available to references, keyed
+	// by their scheme
+	secretProviders = map[string]SecretProvider{
+		"file":  fileSecretProvider{},
+		"vault": newVaultSecretProvider(),
+		"op":    onePasswordSecretProvider{},
+		"awssm": awsSecretsManagerSecretProvider{},
+	}
+	// secretRefs is the global cache of resolved references used by Kruise
+	secretRefs = &secretRefCache{entries: make(map[string]*secretRefEntry)}
+	// secretProvidersMu guards secretProviders
+	secretProvidersMu sync.RWMutex
+)
+
+// RegisterSecretProvider is used to make a SecretProvider available to
+// references with the given scheme, replacing any existing provider
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProvidersMu.Lock()
+	defer secretProvidersMu.Unlock()
+	secretProviders[scheme] = p
+}
+
+// parseSecretRef is used to split a provider://path#key reference into its
+// provider scheme, path and key
+func parseSecretRef(ref string) (string, string, string, error) {
+	scheme, rest, ok := strings.Cut(ref, "://")
+	if !ok || scheme == "" || rest == "" {
+		return "", "", "", fmt.Errorf("invalid secret reference %q, expected provider://path#key", ref)
+	}
+	path, key, _ := strings.Cut(rest, "#")
+	return scheme, path, key, nil
+}
+
+// resolveSecretRef is used to get the value of a provider://path#key reference
+//
+// Values are cached for the rest of the run and registered as sensitive.
+func resolveSecretRef(ref string) (string, error) {
+	scheme, path, key, err := parseSecretRef(ref)
+	if err != nil {
+		return "", err
+	}
+	secretProvidersMu.RLock()
+	p, ok := secretProviders[scheme]
+	secretProvidersMu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown secret provider %q in %s", scheme, ref)
+	}
+	var v string
+	if f, ok := p.(secretFetcher); ok {
+		var secret []byte
+		secret, err = secretRefs.get(scheme+"://"+path, func() ([]byte, error) {
+			Logger.Debugf("Fetching secret: %s://%s", scheme, path)
+			return f.fetch(path)
+		})
+		if err == nil {
+			v, err = f.pick(secret, key)
+		}
+	} else {
+		var secret []byte
+		secret, err = secretRefs.get(ref, func() ([]byte, error) {
+			Logger.Debugf("Resolving secret reference: %s", ref)
+			v, err := p.Get(path, key)
+			return []byte(v), err
+		})
+		v = string(secret)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", ref, err)
+	}
+	registerSecret(v)
+	return v, nil
+}
+
+// get is used to get a cached secret, fetching it if it hasn't been fetched
+// yet
+//
+// Concurrent calls for the same secret wait for a single fetch. Failed fetches
+// aren't cached, so the next call tries again.
+func (c *secretRefCache) get(id string, fetch func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	e, ok := c.entries[id]
+	if !ok {
+		e = &secretRefEntry{}
+		c.entries[id] = e
+	}
+	c.mu.Unlock()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.done {
+		return e.secret, nil
+	}
+	secret, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	e.secret, e.done = secret, true
+	return secret, nil
+}
+
+// secretKey is used to pick the value of the given key from the keys and
+// values of a secret
+//
+// If no key is given, the secret must only hold one value.
+func secretKey(data map[string]interface{}, key string) (string, error) {
+	if key == "" {
+		if len(data) != 1 {
+			var keys []string
+			for k := range data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return "", fmt.Errorf("a #key is required to pick one of %s", strings.Join(keys, ", "))
+		}
+		for k := range data {
+			key = k
+		}
+	}
+	v, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", key)
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// Get is used to read a key from a local file store, which is decrypted with
+// SOPS if it has SOPS metadata and with age otherwise
+func (f fileSecretProvider) Get(path string, key string) (string, error) {
+	secret, err := f.fetch(path)
+	if err != nil {
+		return "", err
+	}
+	return f.pick(secret, key)
+}
+
+// fetch is used to read and decrypt a local file store
+func (fileSecretProvider) fetch(path string) ([]byte, error) {
+	b, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, err
+	}
+	if isSOPSEncrypted(b) {
+		return sopsDecrypt(expandHome(path))
+	}
+	return ageDecrypt(b)
+}
+
+// pick is used to get the value of a key from a decrypted file store
+func (fileSecretProvider) pick(secret []byte, key string) (string, error) {
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(secret, &data); err != nil {
+		return "", fmt.Errorf("invalid file store: %w", err)
+	}
+	return secretKey(data, key)
+}
+
+// Get is used to read a field of a 1Password item with op read, where the path
+// is the vault and item and the key is the field
+func (onePasswordSecretProvider) Get(path string, key string) (string, error) {
+	if key == "" {
+		return "", errors.New("a #field is required")
+	}
+	if _, err := exec.LookPath("op"); err != nil {
+		return "", errors.New("the 1Password CLI (op) must be installed")
+	}
+	out, err := NewCmd("op").
+		WithArgs([]string{"read", "--no-newline", fmt.Sprintf("op://%s/%s", path, key)}).
+		Build().
+		Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Get is used to read an AWS Secrets Manager secret with the aws CLI, picking
+// the given key if the secret is a JSON object
+func (a awsSecretsManagerSecretProvider) Get(path string, key string) (string, error) {
+	secret, err := a.fetch(path)
+	if err != nil {
+		return "", err
+	}
+	return a.pick(secret, key)
+}
+
+// fetch is used to read the secret string of an AWS Secrets Manager secret
+func (awsSecretsManagerSecretProvider) fetch(path string) ([]byte, error) {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return nil, errors.New("the AWS CLI (aws) must be installed")
+	}
+	out, err := NewCmd("aws").
+		WithArgs([]string{
+			"secretsmanager",
+			"get-secret-value",
+			"--secret-id",
+			path,
+			"--query",
+			"SecretString",
+			"--output",
+			"text",
+		}).
+		Build().
+		Output()
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(out, "\r\n"), nil
+}
+
+// pick is used to get the value of a key from an AWS Secrets Manager secret
+// string, which is the whole string if no key is given
+func (awsSecretsManagerSecretProvider) pick(secret []byte, key string) (string, error) {
+	if key == "" {
+		return string(secret), nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(secret, &data); err != nil {
+		return "", fmt.Errorf("a #key was given but the secret isn't a JSON object: %w", err)
+	}
+	return secretKey(data, key)
+}
@@ -0,0 +1,137 @@
+package kruise
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecretRef(t *testing.T) {
+	scheme, path, key, err := parseSecretRef("vault://secret/app#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault", scheme)
+	assert.Equal(t, "secret/app", path)
+	assert.Equal(t, "password", key)
+	_, path, key, err = parseSecretRef("file://~/secrets.age")
+	assert.NoError(t, err)
+	assert.Equal(t, "~/secrets.age", path)
+	assert.Equal(t, "", key)
+	_, _, _, err = parseSecretRef("secret/app#password")
+	assert.Error(t, err)
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	isolateSecrets(t)
+	InitializeLogger()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/app":
+			w.Write([]byte(`{"data":{"data":{"username":"admin","password":"vault-pass"},"metadata":{"version":1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "root")
+
+	v, err := resolveSecretRef("vault://secret/app#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault-pass", v)
+	v, err = resolveSecretRef("vault://secret/app#password")
+	assert.NoError(t, err)
+	assert.Equal(t, "vault-pass", v)
+	v, err = resolveSecretRef("vault://secret/app#username")
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", v)
+	assert.Equal(t, 1, requests, "secrets should be fetched once per path")
+	assert.Equal(t, "***", redact("vault-pass"))
+
+	_, err = resolveSecretRef("vault://secret/app")
+	assert.ErrorContains(t, err, "password, username")
+	_, err = resolveSecretRef("vault://secret/app#missing")
+	assert.Error(t, err)
+	_, err = resolveSecretRef("vault://secret/other#password")
+	assert.ErrorContains(t, err, "404")
+	t.Setenv("VAULT_TOKEN", "wrong")
+	_, err = resolveSecretRef("vault://secret/other#username")
+	assert.ErrorContains(t, err, "permission denied")
+	_, err = resolveSecretRef("nope://secret/app#username")
+	assert.ErrorContains(t, err, "unknown secret provider")
+}
+
+// blockingSecretProvider is a SecretProvider that blocks reads of the blocked
+// path until another path has been read
+type blockingSecretProvider struct {
+	unblock chan struct{}
+}
+
+func (p blockingSecretProvider) Get(path string, key string) (string, error) {
+	if path == "blocked" {
+		select {
+		case <-p.unblock:
+		case <-time.After(5 * time.Second):
+			return "", errors.New("timed out")
+		}
+	} else {
+		close(p.unblock)
+	}
+	return path + "-" + key, nil
+}
+
+func TestResolveSecretRefConcurrently(t *testing.T) {
+	isolateSecrets(t)
+	InitializeLogger()
+	RegisterSecretProvider("blocking", blockingSecretProvider{make(chan struct{})})
+	t.Cleanup(func() { delete(secretProviders, "blocking") })
+	errs := make(chan error)
+	go func() {
+		_, err := resolveSecretRef("blocking://blocked#key")
+		errs <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	v, err := resolveSecretRef("blocking://other#key")
+	assert.NoError(t, err)
+	assert.Equal(t, "other-key", v)
+	assert.NoError(t, <-errs, "a slow read shouldn't hold up other references")
+}
+
+func TestFileSecretProvider(t *testing.T) {
+	isolateSecrets(t)
+	id, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	t.Setenv("SOPS_AGE_KEY", id.String())
+	var ct bytes.Buffer
+	w, err := age.Encrypt(&ct, id.Recipient())
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("db-password: file-pass\nport: 5432\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	path := filepath.Join(t.TempDir(), "secrets.age")
+	assert.NoError(t, os.WriteFile(path, ct.Bytes(), 0600))
+
+	v, err := fileSecretProvider{}.Get(path, "db-password")
+	assert.NoError(t, err)
+	assert.Equal(t, "file-pass", v)
+	v, err = fileSecretProvider{}.Get(path, "port")
+	assert.NoError(t, err)
+	assert.Equal(t, "5432", v)
+	_, err = fileSecretProvider{}.Get(path, "")
+	assert.Error(t, err)
+}
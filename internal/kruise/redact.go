@@ -0,0 +1,81 @@
+package kruise
+
+import (
+	"encoding/base64"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// redactor keeps track of the sensitive values seen during a run so that
+	// they can be masked in anything Kruise prints
+	redactor struct {
+		mu      sync.RWMutex
+		secrets map[string]bool
+	}
+	// redactWriter is an io.Writer that masks sensitive values before writing
+	// to the underlying io.Writer
+	redactWriter struct {
+		w io.Writer
+	}
+)
+
+const (
+	// redacted is the mask that sensitive values are replaced with
+	redacted = "***"
+	// minSecretLength is the length below which sensitive values aren't masked,
+	// since masking every occurrence of a character or two would mangle all
+	// output
+	minSecretLength = 4
+)
+
+// secrets is the global redactor used by Kruise
+var secrets = &redactor{secrets: make(map[string]bool)}
+
+// registerSecret is used to mark a value as sensitive so that it, and its
+// base64 encoding, are masked in any output
+//
+// Values shorter than minSecretLength are ignored.
+func registerSecret(v string) {
+	if len(v) < minSecretLength || v == redacted {
+		return
+	}
+	secrets.mu.Lock()
+	defer secrets.mu.Unlock()
+	secrets.secrets[v] = true
+	secrets.secrets[base64.StdEncoding.EncodeToString([]byte(v))] = true
+}
+
+// redact is used to mask every registered sensitive value in the given string
+//
+// Longer values are replaced first so that a value containing another value is
+// masked entirely.
+func redact(s string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	if len(secrets.secrets) == 0 {
+		return s
+	}
+	var values []string
+	for v := range secrets.secrets {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	for _, v := range values {
+		s = strings.ReplaceAll(s, v, redacted)
+	}
+	return s
+}
+
+// Write is used to write p to the underlying io.Writer with every registered
+// sensitive value masked
+func (r redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
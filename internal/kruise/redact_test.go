@@ -0,0 +1,42 @@
+package kruise
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// isolateSecrets is used to give a test its own sensitive values, so that the
+// values it registers don't leak into other tests
+func isolateSecrets(t *testing.T) {
+	old, oldRefs := secrets, secretRefs
+	secrets = &redactor{secrets: make(map[string]bool)}
+	secretRefs = &secretRefCache{entries: make(map[string]*secretRefEntry)}
+	t.Cleanup(func() { secrets, secretRefs = old, oldRefs })
+}
+
+func TestRedact(t *testing.T) {
+	isolateSecrets(t)
+	registerSecret("hunter2")
+	registerSecret("hunter2-and-more")
+	registerSecret("")
+	registerSecret("a")
+	assert.Equal(t, "password=***", redact("password=hunter2"))
+	assert.Equal(t, "password=***", redact("password=hunter2-and-more"))
+	assert.Equal(t, "data: ***", redact("data: "+base64.StdEncoding.EncodeToString([]byte("hunter2"))))
+	assert.Equal(t, "name: alpha", redact("name: alpha"))
+	var buf bytes.Buffer
+	w := redactWriter{&buf}
+	n, err := w.Write([]byte("--password hunter2\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, len("--password hunter2\n"), n)
+	assert.Equal(t, "--password ***\n", buf.String())
+}
+
+func TestDockerConfigJSON(t *testing.T) {
+	isolateSecrets(t)
+	b := dockerConfigJSON("ghcr.io", "user", "hunter2")
+	assert.JSONEq(t, `{"auths":{"ghcr.io":{"username":"user","password":"hunter2","auth":"dXNlcjpodW50ZXIy"}}}`, string(b))
+}
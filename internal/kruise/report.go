@@ -0,0 +1,406 @@
+package kruise
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+type (
+	// Result represents the outcome of installing or uninstalling an Installer
+	//
+	// The duration is in seconds. The exit code is that of the command the
+	// Installer failed on, or 1 if it failed some other way.
+	Result struct {
+		Deployment string  `json:"deployment,omitempty"`
+		Type       string  `json:"type"`
+		Name       string  `json:"name"`
+		Namespace  string  `json:"namespace,omitempty"`
+		Status     string  `json:"status"`
+		Duration   float64 `json:"duration"`
+		ExitCode   int     `json:"exitCode"`
+		Error      string  `json:"error,omitempty"`
+	}
+
+	// report collects the Result of each Installer of a deploy or delete
+	// from the error each of them returns
+	report struct {
+		mu      sync.Mutex
+		command string
+		files   []string
+		dry     bool
+		start   time.Time
+		results []Result
+		keys    []string
+		claimed []bool
+		started []time.Time
+		cleanup func()
+	}
+
+	// resultFile represents the contents of a JSON report
+	resultFile struct {
+		Command   string   `json:"command"`
+		DryRun    bool     `json:"dryRun"`
+		Duration  float64  `json:"duration"`
+		Succeeded int      `json:"succeeded"`
+		Failed    int      `json:"failed"`
+		Skipped   int      `json:"skipped"`
+		Results   []Result `json:"results"`
+	}
+
+	// junitTestSuites represents the contents of a JUnit report, with a test
+	// suite per deployment and a test case per Installer
+	junitTestSuites struct {
+		XMLName  xml.Name         `xml:"testsuites"`
+		Name     string           `xml:"name,attr"`
+		Tests    int              `xml:"tests,attr"`
+		Failures int              `xml:"failures,attr"`
+		Skipped  int              `xml:"skipped,attr"`
+		Time     string           `xml:"time,attr"`
+		Suites   []junitTestSuite `xml:"testsuite"`
+	}
+
+	// junitTestSuite represents the Installers of a deployment in a JUnit
+	// report
+	junitTestSuite struct {
+		Name     string          `xml:"name,attr"`
+		Tests    int             `xml:"tests,attr"`
+		Failures int             `xml:"failures,attr"`
+		Skipped  int             `xml:"skipped,attr"`
+		Time     string          `xml:"time,attr"`
+		Cases    []junitTestCase `xml:"testcase"`
+	}
+
+	// junitTestCase represents an Installer in a JUnit report
+	junitTestCase struct {
+		Name      string        `xml:"name,attr"`
+		ClassName string        `xml:"classname,attr"`
+		Time      string        `xml:"time,attr"`
+		Failure   *junitFailure `xml:"failure,omitempty"`
+		Skipped   *struct{}     `xml:"skipped,omitempty"`
+	}
+
+	// junitFailure represents the error of a failed Installer in a JUnit
+	// report
+	junitFailure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+)
+
+const (
+	resultRunning   = "running"
+	resultSucceeded = "succeeded"
+	resultFailed    = "failed"
+	resultSkipped   = "skipped"
+)
+
+// results is the report of the deploy or delete that is running, if any
+var results *report
+
+// startReport is used to start collecting the Result of each of the given
+// Installers, which belong to the given Deployments
+//
+// Installers that never run are reported as skipped. The formats of the
+// files given with the report flag are checked up front and their paths are
+// resolved against the current working directory.
+func startReport(fs *pflag.FlagSet, command string, deps Deployments, installers Installers) {
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	files, err := fs.GetStringSlice("report")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	for n, f := range files {
+		if ext := filepath.Ext(f); ext != ".xml" && ext != ".json" {
+			Logger.Fatalf("Unable to write a report to %s: the file must end in .xml for JUnit or .json", f)
+		}
+		files[n], err = filepath.Abs(f)
+		if err != nil {
+			Logger.Fatal(err)
+		}
+	}
+	origins := installerOrigins(deps)
+	r := &report{command: command, files: files, dry: d, start: time.Now()}
+	for _, i := range installers {
+		typ, name, ns := describe(i)
+		var dep string
+		if o := origins[originKey(i)]; len(o) > 0 {
+			dep = o[0].deployment
+		}
+		r.results = append(r.results, Result{
+			Deployment: dep,
+			Type:       typ,
+			Name:       name,
+			Namespace:  ns,
+			Status:     resultSkipped,
+		})
+		r.keys = append(r.keys, resultKey(i))
+		r.claimed = append(r.claimed, false)
+		r.started = append(r.started, time.Time{})
+	}
+	// the report is finished however Kruise exits, so that it is still
+	// written if a fatal error stops Kruise early
+	r.cleanup = atExit(r.finish)
+	results = r
+}
+
+// finishReport is used to stop collecting Results, print a summary of them and
+// write them to the files given with the report flag
+func finishReport() {
+	if r := results; r != nil {
+		r.cleanup()
+	}
+}
+
+// finish is used to print a summary of the Results and write them to the
+// files given with the report flag
+//
+// Any Installer that is still running is reported as failed, since that only
+// happens when a fatal error stops Kruise early. The summary isn't printed
+// during a dry run, so that the output is only the commands that would have
+// run.
+func (r *report) finish() {
+	results = nil
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for n := range r.results {
+		if res := &r.results[n]; res.Status == resultRunning {
+			res.Status = resultFailed
+			res.ExitCode = 1
+			res.Error = "interrupted by a fatal error"
+			res.Duration = time.Since(r.started[n]).Seconds()
+		}
+	}
+	if !r.dry {
+		r.printSummary(redactWriter{os.Stdout})
+	}
+	for _, f := range r.files {
+		if err := r.write(f); err != nil {
+			Logger.Errorf("Unable to write a report to %s: %v", f, err)
+		}
+	}
+}
+
+// record is used to start timing the Result of the given Installer, returning
+// the function that stops it with the error the Installer failed with, if any
+func record(i Installer) func(error) {
+	r := results
+	if r == nil {
+		return func(error) {}
+	}
+	r.mu.Lock()
+	n := r.claim(i)
+	r.started[n] = time.Now()
+	r.results[n].Status = resultRunning
+	r.mu.Unlock()
+	return func(err error) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		res := &r.results[n]
+		if res.Status != resultRunning {
+			// already reported as interrupted
+			return
+		}
+		res.Duration = time.Since(r.started[n]).Seconds()
+		res.Status = resultSucceeded
+		if err != nil {
+			res.Status = resultFailed
+			res.ExitCode = exitCode(err)
+			res.Error = redact(strings.TrimSpace(err.Error()))
+		}
+	}
+}
+
+// claim is used to get the index of the first unclaimed Result of the given
+// Installer, adding one if it wasn't registered up front
+func (r *report) claim(i Installer) int {
+	key := resultKey(i)
+	for n, k := range r.keys {
+		if k == key && !r.claimed[n] {
+			r.claimed[n] = true
+			return n
+		}
+	}
+	typ, name, ns := describe(i)
+	r.results = append(r.results, Result{Type: typ, Name: name, Namespace: ns})
+	r.keys = append(r.keys, key)
+	r.claimed = append(r.claimed, true)
+	r.started = append(r.started, time.Time{})
+	return len(r.results) - 1
+}
+
+// setLogOutput is used to set where the Logger writes to
+func setLogOutput(w io.Writer) {
+	Logger.SetOutput(redactWriter{w})
+}
+
+// printSummary is used to print a table of the Results
+func (r *report) printSummary(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nTYPE\tNAME\tNAMESPACE\tSTATUS\tDURATION")
+	for _, res := range r.results {
+		d := ""
+		if res.Status != resultSkipped {
+			d = (time.Duration(res.Duration * float64(time.Second))).Round(100 * time.Millisecond).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", res.Type, res.Name, res.Namespace, res.Status, d)
+	}
+	tw.Flush()
+	s, f, k := r.counts(r.results)
+	fmt.Fprintf(w, "\n%d succeeded, %d failed, %d skipped in %s\n", s, f, k, time.Since(r.start).Round(time.Second))
+}
+
+// counts is used to count the given Results that succeeded, failed and were
+// skipped
+func (r *report) counts(rs []Result) (int, int, int) {
+	var s, f, k int
+	for _, res := range rs {
+		switch res.Status {
+		case resultSucceeded:
+			s++
+		case resultFailed:
+			f++
+		default:
+			k++
+		}
+	}
+	return s, f, k
+}
+
+// write is used to write the Results to the given file, as JUnit if it ends
+// in .xml or JSON otherwise
+func (r *report) write(path string) error {
+	var b []byte
+	var err error
+	if filepath.Ext(path) == ".xml" {
+		b, err = xml.MarshalIndent(r.junit(), "", "  ")
+		b = append([]byte(xml.Header), b...)
+	} else {
+		s, f, k := r.counts(r.results)
+		b, err = json.MarshalIndent(resultFile{
+			Command:   r.command,
+			DryRun:    r.dry,
+			Duration:  time.Since(r.start).Seconds(),
+			Succeeded: s,
+			Failed:    f,
+			Skipped:   k,
+			Results:   r.results,
+		}, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(redact(string(b))+"\n"), 0644)
+}
+
+// junit is used to build a JUnit report of the Results, with a test suite per
+// deployment in the order they were passed
+func (r *report) junit() junitTestSuites {
+	var order []string
+	byDep := make(map[string][]Result)
+	for _, res := range r.results {
+		dep := res.Deployment
+		if dep == "" {
+			dep = r.command
+		}
+		if _, ok := byDep[dep]; !ok {
+			order = append(order, dep)
+		}
+		byDep[dep] = append(byDep[dep], res)
+	}
+	_, f, k := r.counts(r.results)
+	suites := junitTestSuites{
+		Name:     "kruise " + r.command,
+		Tests:    len(r.results),
+		Failures: f,
+		Skipped:  k,
+		Time:     seconds(time.Since(r.start).Seconds()),
+	}
+	for _, dep := range order {
+		rs := byDep[dep]
+		_, f, k := r.counts(rs)
+		suite := junitTestSuite{Name: dep, Tests: len(rs), Failures: f, Skipped: k}
+		var total float64
+		for _, res := range rs {
+			total += res.Duration
+			tc := junitTestCase{
+				Name:      res.Type + " " + res.Name,
+				ClassName: dep,
+				Time:      seconds(res.Duration),
+			}
+			switch res.Status {
+			case resultFailed:
+				tc.Failure = &junitFailure{Message: strings.SplitN(res.Error, "\n", 2)[0], Text: res.Error}
+			case resultSkipped:
+				tc.Skipped = &struct{}{}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Time = seconds(total)
+		suites.Suites = append(suites.Suites, suite)
+	}
+	return suites
+}
+
+// describe is used to get the type, name and namespace of an Installer
+func describe(i Installer) (string, string, string) {
+	switch i := i.(type) {
+	case HelmChart:
+		return "chart", i.ReleaseName, i.Namespace
+	case HelmRepository:
+		return "repository", i.Name, ""
+	case KubectlManifest:
+		return "manifest", strings.Join(i.Paths, ", "), i.Namespace
+	case KubectlKustomization:
+		return "kustomization", i.Path, i.Namespace
+	case Exec:
+		return "exec", i.Name, ""
+	case KubectlGenericSecret:
+		return "secret", i.Name, strings.Join(i.Namespaces, ", ")
+	case KubectlDockerRegistrySecret:
+		return "secret", i.Name, strings.Join(i.Namespaces, ", ")
+	case KubectlTLSSecret:
+		return "secret", i.Name, strings.Join(i.Namespaces, ", ")
+	case KubectlBasicAuthSecret:
+		return "secret", i.Name, strings.Join(i.Namespaces, ", ")
+	case KubectlSSHAuthSecret:
+		return "secret", i.Name, strings.Join(i.Namespaces, ", ")
+	case KubectlServiceAccountTokenSecret:
+		return "secret", i.Name, strings.Join(i.Namespaces, ", ")
+	}
+	return fmt.Sprintf("%T", i), "", ""
+}
+
+// resultKey is used to identify the Result of an Installer
+func resultKey(i Installer) string {
+	typ, name, ns := describe(i)
+	return fmt.Sprintf("%s/%s/%s/%d", typ, ns, name, i.GetPriority())
+}
+
+// exitCode is used to get the exit code of the command an Installer failed
+// on, or 1 if it failed some other way
+func exitCode(err error) int {
+	var e interface{ ExitCode() int }
+	if errors.As(err, &e) {
+		return e.ExitCode()
+	}
+	return 1
+}
+
+// seconds is used to format a duration in seconds for a JUnit report
+func seconds(s float64) string {
+	return fmt.Sprintf("%.3f", s)
+}
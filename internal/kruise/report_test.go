@@ -0,0 +1,93 @@
+package kruise
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	InitializeLogger()
+	dir := t.TempDir()
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", false, "")
+	fs.StringSlice("report", []string{filepath.Join(dir, "junit.xml"), filepath.Join(dir, "result.json")}, "")
+	// a stand-in kubectl that fails to apply anything
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "kubectl"), []byte("#!/bin/sh\n[ \"$1\" = apply ] || exit 0\necho nope >&2\nexit 3\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	ok := newExec(latest.Exec{Name: "ok", InstallCommand: "true"})
+	broken := newKubectlManifest(latest.KubectlManifest{Namespace: "broken", Paths: []string{"broken.yaml"}})
+	skipped := newExec(latest.Exec{Name: "skipped", InstallCommand: "true"})
+	startReport(fs, "deploy", nil, Installers{ok, broken, skipped})
+	captureStdout(func() {
+		installs(fs, ok, broken)
+		finishReport()
+	})
+
+	b, err := os.ReadFile(filepath.Join(dir, "result.json"))
+	require.NoError(t, err)
+	var rf resultFile
+	require.NoError(t, json.Unmarshal(b, &rf))
+	assert.Equal(t, 1, rf.Succeeded)
+	assert.Equal(t, 1, rf.Failed)
+	assert.Equal(t, 1, rf.Skipped)
+	assert.Equal(t, resultSucceeded, rf.Results[0].Status)
+	assert.Equal(t, resultFailed, rf.Results[1].Status)
+	assert.Equal(t, 3, rf.Results[1].ExitCode)
+	assert.Equal(t, "nope", rf.Results[1].Error)
+	assert.Equal(t, resultSkipped, rf.Results[2].Status)
+
+	b, err = os.ReadFile(filepath.Join(dir, "junit.xml"))
+	require.NoError(t, err)
+	var ju junitTestSuites
+	require.NoError(t, xml.Unmarshal(b, &ju))
+	assert.Equal(t, 3, ju.Tests)
+	require.Len(t, ju.Suites, 1)
+	assert.Equal(t, "deploy", ju.Suites[0].Name)
+	require.Len(t, ju.Suites[0].Cases, 3)
+	assert.Equal(t, "manifest broken.yaml", ju.Suites[0].Cases[1].Name)
+	require.NotNil(t, ju.Suites[0].Cases[1].Failure)
+	assert.Equal(t, "nope", ju.Suites[0].Cases[1].Failure.Message)
+	assert.NotNil(t, ju.Suites[0].Cases[2].Skipped)
+}
+
+func TestReportWrittenOnFatal(t *testing.T) {
+	if os.Getenv("KRUISE_TEST_FATAL_REPORT") == "1" {
+		InitializeLogger()
+		fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		fs.Bool("dry-run", true, "")
+		fs.StringSlice("report", []string{"result.json"}, "")
+		running := newExec(latest.Exec{Name: "running", InstallCommand: "true"})
+		startReport(fs, "deploy", nil, Installers{running})
+		record(running)
+		Logger.Fatal("stopped")
+		return
+	}
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	t.Cleanup(func() { os.Chdir(wd) })
+	cmd := exec.Command(os.Args[0], "-test.run=^TestReportWrittenOnFatal$")
+	cmd.Env = append(os.Environ(), "KRUISE_TEST_FATAL_REPORT=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	assert.ErrorAs(t, err, &exitErr, string(out))
+
+	b, err := os.ReadFile(filepath.Join(dir, "result.json"))
+	require.NoError(t, err, string(out))
+	var rf resultFile
+	require.NoError(t, json.Unmarshal(b, &rf))
+	require.Len(t, rf.Results, 1)
+	assert.Equal(t, resultFailed, rf.Results[0].Status)
+	assert.Equal(t, "interrupted by a fatal error", rf.Results[0].Error)
+}
@@ -0,0 +1,451 @@
+package kruise
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+)
+
+// contentHashAnnotation is the annotation used to record the hash of the
+// content of a secret created by Kruise
+const contentHashAnnotation = "kruise/content-hash"
+
+// selfSignedAnnotation is the annotation used to record the hash of the hosts
+// and validity that the self-signed certificate of a tls secret was generated
+// for
+const selfSignedAnnotation = "kruise/self-signed"
+
+type (
+	// kubernetesSecret represents a Kubernetes Secret object that Kruise
+	// generates and passes to kubectl on stdin so that sensitive values never
+	// appear as command line arguments
+	kubernetesSecret struct {
+		APIVersion string             `yaml:"apiVersion"`
+		Kind       string             `yaml:"kind"`
+		Metadata   kubernetesMetadata `yaml:"metadata"`
+		Type       string             `yaml:"type,omitempty"`
+		StringData map[string]string  `yaml:"stringData,omitempty"`
+		Data       map[string]string  `yaml:"data,omitempty"`
+	}
+	// kubernetesMetadata represents the metadata of a Kubernetes object
+	kubernetesMetadata struct {
+		Name        string            `yaml:"name"`
+		Namespace   string            `yaml:"namespace,omitempty"`
+		Labels      map[string]string `yaml:"labels,omitempty"`
+		Annotations map[string]string `yaml:"annotations,omitempty"`
+	}
+)
+
+// newKubernetesSecret is used to create a Kubernetes Secret object of the
+// given type
+//
+// Values that are valid UTF-8 are stored as stringData to keep dry-run output
+// readable; anything else is base64 encoded as data.
+func newKubernetesSecret(name string, namespace string, typ string, data map[string][]byte) kubernetesSecret {
+	s := kubernetesSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata:   kubernetesMetadata{Name: name, Namespace: namespace},
+		Type:       typ,
+	}
+	for k, v := range data {
+		if utf8.Valid(v) {
+			if s.StringData == nil {
+				s.StringData = make(map[string]string)
+			}
+			s.StringData[k] = string(v)
+			continue
+		}
+		if s.Data == nil {
+			s.Data = make(map[string]string)
+		}
+		s.Data[k] = base64.StdEncoding.EncodeToString(v)
+	}
+	return s
+}
+
+// data is used to gather the data of a generic secret from its literals, files,
+// env files and commands, prompting for any literal without a value
+//
+// Every value is registered as sensitive. Commands aren't run, references
+// aren't resolved and literals aren't prompted for during a dry run.
+func (s KubectlGenericSecret) data(fs *pflag.FlagSet, dry bool) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	add := func(k string, v []byte) error {
+		if _, ok := data[k]; ok {
+			return fmt.Errorf("duplicate key %s", k)
+		}
+		registerSecret(string(v))
+		data[k] = v
+		return nil
+	}
+	for _, f := range s.FromEnvFile {
+		env, err := parseEnvFile(expandHome(f))
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range env {
+			if err := add(kv.Key, []byte(kv.Val)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, f := range s.FromFile {
+		k := f.Key
+		if k == "" {
+			k = filepath.Base(f.Path)
+		}
+		v, err := os.ReadFile(expandHome(f.Path))
+		if err != nil {
+			return nil, err
+		}
+		if err := add(k, v); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range s.FromCommand {
+		v := redacted
+		if !dry {
+			var err error
+			v, err = resolveSecretSource(latest.SecretSource{Command: c.Command})
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := add(c.Key, []byte(v)); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range s.Literal {
+		v := redacted
+		switch {
+		case dry && (l.Ref != "" || isEncrypted(l.Val)):
+			// secret providers and encrypted values aren't used during a dry run
+		case l.Ref != "":
+			var err error
+			v, err = resolveSecretRef(l.Ref)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", l.Key, err)
+			}
+		case isEncrypted(l.Val):
+			var err error
+			v, err = decryptValue(l.Val)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", l.Key, err)
+			}
+		case l.Val != "":
+			v = l.Val
+		case !dry:
+			v = sensitiveInputPrompt(fs, fmt.Sprintf("Please enter a value for key: %s", l.Key))
+		}
+		if err := add(l.Key, []byte(v)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// certificate is used to read the certificate and key of a tls secret, or
+// generate a self-signed certificate if neither is set
+//
+// Nothing is generated during a dry run.
+func (s KubectlTLSSecret) certificate(dry bool) ([]byte, []byte, error) {
+	switch {
+	case s.Cert != "" && s.Key != "":
+		cert, err := os.ReadFile(expandHome(s.Cert))
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := os.ReadFile(expandHome(s.Key))
+		if err != nil {
+			return nil, nil, err
+		}
+		return cert, key, nil
+	case s.Cert != "" || s.Key != "":
+		return nil, nil, errors.New("both cert and key must be set")
+	case len(s.SelfSigned.Hosts) == 0:
+		return nil, nil, errors.New("either cert and key or selfSigned hosts must be set")
+	case dry:
+		return []byte(redacted), []byte(redacted), nil
+	}
+	validFor := 365 * 24 * time.Hour
+	if s.SelfSigned.ValidFor != "" {
+		var err error
+		validFor, err = time.ParseDuration(s.SelfSigned.ValidFor)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid validFor: %w", err)
+		}
+	}
+	return selfSignedCert(s.SelfSigned.Hosts, validFor)
+}
+
+// selfSigned is used to determine whether the tls secret is a generated
+// self-signed certificate rather than one read from files
+func (s KubectlTLSSecret) selfSigned() bool {
+	return s.Cert == "" && s.Key == "" && len(s.SelfSigned.Hosts) > 0
+}
+
+// selfSignedHash is used to hash what the self-signed certificate of a tls
+// secret is generated from
+func (s KubectlTLSSecret) selfSignedHash() string {
+	sum := sha256.Sum256([]byte(strings.Join(s.SelfSigned.Hosts, "\x00") + "\x00" + s.SelfSigned.ValidFor))
+	return hex.EncodeToString(sum[:])
+}
+
+// deployedCertificate is used to get the certificate and key of a self-signed
+// tls secret that already exists in one of the given namespaces
+//
+// They are only reused if they were generated for the same hosts and validity
+// and the certificate hasn't expired, so that changing either, or deleting the
+// secret, generates a new certificate. Nothing is looked up during a dry run.
+func (s KubectlTLSSecret) deployedCertificate(dry bool, namespaces []string) ([]byte, []byte, bool) {
+	if dry || !s.selfSigned() {
+		return nil, nil, false
+	}
+	for _, ns := range namespaces {
+		out, err := NewCmd("kubectl").
+			WithArgs([]string{"get", "secret", s.Name, "--namespace", ns, "--output", "json"}).
+			Build().
+			Output()
+		if err != nil {
+			Logger.Debug(err)
+			continue
+		}
+		var existing struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+			Data map[string][]byte `json:"data"`
+		}
+		if err := json.Unmarshal(out, &existing); err != nil {
+			Logger.Debug(err)
+			continue
+		}
+		if existing.Metadata.Annotations[selfSignedAnnotation] != s.selfSignedHash() {
+			continue
+		}
+		cert, key := existing.Data["tls.crt"], existing.Data["tls.key"]
+		block, _ := pem.Decode(cert)
+		if block == nil || len(key) == 0 {
+			continue
+		}
+		parsed, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || time.Now().After(parsed.NotAfter) {
+			continue
+		}
+		Logger.Debugf("Reusing the self-signed certificate of tls secret %s in the %s namespace", s.Name, ns)
+		return cert, key, true
+	}
+	return nil, nil, false
+}
+
+// selfSignedCert is used to generate a PEM encoded self-signed certificate and
+// ECDSA key for the given hosts, which may be DNS names or IP addresses
+func selfSignedCert(hosts []string, validFor time.Duration) ([]byte, []byte, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             now,
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}),
+		nil
+}
+
+// data is used to resolve the private key and known hosts of an ssh-auth
+// secret
+//
+// Like other credential sources, they aren't resolved during a dry run.
+func (s KubectlSSHAuthSecret) data(dry bool) (map[string][]byte, error) {
+	if dry {
+		return map[string][]byte{"ssh-privatekey": []byte(redacted)}, nil
+	}
+	key, err := resolveSecretSource(s.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return nil, errors.New("no privateKey was resolved")
+	}
+	registerSecret(key)
+	// ssh refuses to load a private key without a trailing newline
+	data := map[string][]byte{"ssh-privatekey": []byte(key + "\n")}
+	hosts, err := resolveSecretSource(s.KnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	if hosts != "" {
+		data["known_hosts"] = []byte(hosts + "\n")
+	}
+	return data, nil
+}
+
+// parseEnvFile is used to parse a file of KEY=VALUE lines the same way kubectl
+// does for --from-env-file
+//
+// Blank lines and lines starting with # are skipped and values are used as-is
+// without any quote processing.
+func parseEnvFile(path string) ([]latest.KeyVal, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var env []latest.KeyVal
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		env = append(env, latest.KeyVal{Key: k, Val: v})
+	}
+	return env, scanner.Err()
+}
+
+// keyValMap is used to convert a list of KeyVals to a map
+func keyValMap(kvs []latest.KeyVal) map[string]string {
+	if len(kvs) == 0 {
+		return nil
+	}
+	m := make(map[string]string)
+	for _, kv := range kvs {
+		m[kv.Key] = kv.Val
+	}
+	return m
+}
+
+// manifest is used to serialize the Kubernetes Secret object
+func (s kubernetesSecret) manifest() []byte {
+	b, err := marshalYAML(s)
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	return b
+}
+
+// dockerConfigJSON is used to build the .dockerconfigjson of a docker-registry
+// secret
+//
+// The result is registered as sensitive since it embeds the password.
+func dockerConfigJSON(server string, username string, password string) []byte {
+	auth := redacted
+	if password != redacted {
+		auth = base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+	}
+	cfg := dockerConfig{
+		Auths: map[string]dockerAuth{
+			server: {Username: username, Password: password, Auth: auth},
+		},
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	registerSecret(auth)
+	registerSecret(string(b))
+	return b
+}
+
+// withContentHash is used to annotate the Kubernetes Secret object with a hash
+// of its content
+func (s kubernetesSecret) withContentHash() kubernetesSecret {
+	sum := sha256.Sum256(s.manifest())
+	annotations := map[string]string{contentHashAnnotation: hex.EncodeToString(sum[:])}
+	for k, v := range s.Metadata.Annotations {
+		annotations[k] = v
+	}
+	s.Metadata.Annotations = annotations
+	return s
+}
+
+// unchanged is used to determine whether the Kubernetes Secret object already
+// exists in the cluster with the same content hash
+func (s kubernetesSecret) unchanged() bool {
+	out, err := NewCmd("kubectl").
+		WithArgs([]string{"get", "secret", s.Metadata.Name, "--namespace", s.Metadata.Namespace, "--output", "json"}).
+		Build().
+		Output()
+	if err != nil {
+		Logger.Debug(err)
+		return false
+	}
+	var existing struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(out, &existing); err != nil {
+		Logger.Debug(err)
+		return false
+	}
+	return existing.Metadata.Annotations[contentHashAnnotation] == s.Metadata.Annotations[contentHashAnnotation]
+}
+
+// kubectlApplySecret is used to execute a kubectl apply command for the given
+// Kubernetes Secret object, which is passed on stdin
+//
+// Server-side apply is used since client-side apply would copy the secret's
+// data into its last-applied-configuration annotation.
+func kubectlApplySecret(out io.Writer, dry bool, s kubernetesSecret) error {
+	return NewCmd("kubectl").
+		WithArgs([]string{"apply", "--server-side", "--field-manager", "kruise", "--force-conflicts", "-f", "-"}).
+		WithStdin(s.manifest()).
+		WithDryRun(dry).
+		WithOutput(out).
+		Build().
+		Execute()
+}
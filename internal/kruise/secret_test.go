@@ -0,0 +1,104 @@
+package kruise
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEnvFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.env")
+	content := "# comment\n\nUSER=admin\n  URL=postgres://db?sslmode=disable\nQUOTED=\"kept\"\n"
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	env, err := parseEnvFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []latest.KeyVal{
+		{Key: "USER", Val: "admin"},
+		{Key: "URL", Val: "postgres://db?sslmode=disable"},
+		{Key: "QUOTED", Val: "\"kept\""},
+	}, env)
+
+	assert.NoError(t, os.WriteFile(path, []byte("INVALID\n"), 0o600))
+	_, err = parseEnvFile(path)
+	assert.Error(t, err)
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	certPEM, keyPEM, err := selfSignedCert([]string{"app.localhost", "127.0.0.1"}, time.Hour)
+	assert.NoError(t, err)
+	_, err = tls.X509KeyPair(certPEM, keyPEM)
+	assert.NoError(t, err)
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, "app.localhost", cert.Subject.CommonName)
+	assert.Equal(t, []string{"app.localhost"}, cert.DNSNames)
+	assert.Len(t, cert.IPAddresses, 1)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), cert.NotAfter, time.Minute)
+}
+
+func TestKubectlTLSSecretCertificate(t *testing.T) {
+	s := KubectlTLSSecret{}
+	s.Cert = "tls.crt"
+	_, _, err := s.certificate(true)
+	assert.Error(t, err)
+	s.Cert = ""
+	_, _, err = s.certificate(true)
+	assert.Error(t, err)
+	s.SelfSigned.Hosts = []string{"app.localhost"}
+	s.SelfSigned.ValidFor = "a year"
+	_, _, err = s.certificate(false)
+	assert.Error(t, err)
+	cert, key, err := s.certificate(true)
+	assert.NoError(t, err)
+	assert.Equal(t, redacted, string(cert))
+	assert.Equal(t, redacted, string(key))
+}
+
+func TestKubectlTLSSecretReusesCertificate(t *testing.T) {
+	InitializeLogger()
+	s := newKubectlTLSSecret(latest.KubectlTLSSecret{Name: "dev-tls", SelfSigned: latest.SelfSignedCert{Hosts: []string{"app.localhost"}}})
+	cert, key, err := selfSignedCert(s.SelfSigned.Hosts, time.Hour)
+	assert.NoError(t, err)
+	deployed, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]string{selfSignedAnnotation: s.selfSignedHash()}},
+		"data":     map[string][]byte{"tls.crt": cert, "tls.key": key},
+	})
+	assert.NoError(t, err)
+	// a stand-in kubectl that has already deployed the secret
+	bin := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "deployed.json"), deployed, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "kubectl"), []byte("#!/bin/sh\ncat "+filepath.Join(bin, "deployed.json")+"\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", false, "")
+	secrets := s.secrets(fs, []string{"dev"})
+	assert.Equal(t, string(cert), secrets[0].StringData["tls.crt"])
+	assert.Equal(t, s.selfSignedHash(), secrets[0].Metadata.Annotations[selfSignedAnnotation])
+
+	s.SelfSigned.Hosts = append(s.SelfSigned.Hosts, "api.localhost")
+	secrets = s.secrets(fs, []string{"dev"})
+	assert.NotEqual(t, string(cert), secrets[0].StringData["tls.crt"], "a certificate for other hosts is regenerated")
+}
+
+func TestKubernetesSecretWithContentHash(t *testing.T) {
+	s := newKubernetesSecret("app", "default", "Opaque", map[string][]byte{"password": []byte("hunter2")})
+	s.Metadata.Annotations = map[string]string{"owner": "team"}
+	hashed := s.withContentHash()
+	assert.Len(t, hashed.Metadata.Annotations[contentHashAnnotation], 64)
+	assert.Equal(t, "team", hashed.Metadata.Annotations["owner"])
+	assert.NotContains(t, s.Metadata.Annotations, contentHashAnnotation)
+	assert.Equal(t, hashed, s.withContentHash())
+	changed := newKubernetesSecret("app", "default", "Opaque", map[string][]byte{"password": []byte("hunter3")})
+	changed.Metadata.Annotations = map[string]string{"owner": "team"}
+	assert.NotEqual(t, hashed.Metadata.Annotations[contentHashAnnotation], changed.withContentHash().Metadata.Annotations[contentHashAnnotation])
+}
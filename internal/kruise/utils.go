@@ -6,6 +6,8 @@ import (
 	"os"
 	"regexp"
 	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 // contains is used to generically determine whether an object is contained
@@ -32,6 +34,27 @@ func containsAny[T comparable](list []T, any ...T) bool {
 	return false
 }
 
+// isURL is used to determine whether the given location is a remote URL
+// rather than a local path
+func isURL(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// marshalYAML is used to serialize an object to YAML with the two space
+// indentation used by Kruise config files
+func marshalYAML(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 // captureStdout is used to captureStdout from another function and return it
 // in a string; this is useful for testing
 func captureStdout(f func()) string {
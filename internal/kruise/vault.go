@@ -0,0 +1,115 @@
+package kruise
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+type (
+	// vaultSecretProvider is a SecretProvider for the HashiCorp Vault KV v2
+	// secrets engine
+	//
+	// It is configured the same way as the vault CLI, with the VAULT_ADDR,
+	// VAULT_TOKEN and VAULT_NAMESPACE environment variables, falling back to
+	// the token in ~/.vault-token.
+	vaultSecretProvider struct {
+		client *http.Client
+	}
+
+	// vaultKVResponse represents the response of a Vault KV v2 read
+	vaultKVResponse struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+		Errors []string `json:"errors"`
+	}
+)
+
+// newVaultSecretProvider is used to create a new vaultSecretProvider
+func newVaultSecretProvider() vaultSecretProvider {
+	return vaultSecretProvider{client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Get is used to read a key of a Vault KV v2 secret
+//
+// The first segment of the path is the mount of the secrets engine, so
+// vault://secret/app#password reads the password key of secret/app the same
+// way vault kv get secret/app would.
+func (v vaultSecretProvider) Get(path string, key string) (string, error) {
+	secret, err := v.fetch(path)
+	if err != nil {
+		return "", err
+	}
+	return v.pick(secret, key)
+}
+
+// fetch is used to read the keys and values of a Vault KV v2 secret as JSON
+func (v vaultSecretProvider) fetch(path string) ([]byte, error) {
+	mount, name, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || name == "" {
+		return nil, fmt.Errorf("expected mount/path, got %s", path)
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = "https://127.0.0.1:8200"
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimRight(addr, "/"), mount, name)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var kv vaultKVResponse
+	if err := json.NewDecoder(resp.Body).Decode(&kv); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid response from Vault: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(kv.Errors) > 0 {
+			return nil, fmt.Errorf("vault returned %s: %s", resp.Status, strings.Join(kv.Errors, "; "))
+		}
+		return nil, fmt.Errorf("vault returned %s", resp.Status)
+	}
+	return json.Marshal(kv.Data.Data)
+}
+
+// pick is used to get the value of a key from a fetched Vault KV v2 secret
+func (vaultSecretProvider) pick(secret []byte, key string) (string, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(secret, &data); err != nil {
+		return "", err
+	}
+	return secretKey(data, key)
+}
+
+// vaultToken is used to get the Vault token from the VAULT_TOKEN environment
+// variable or the token helper file written by vault login
+func vaultToken() (string, error) {
+	if t := os.Getenv("VAULT_TOKEN"); t != "" {
+		return t, nil
+	}
+	b, err := os.ReadFile(filepath.Join(xdg.Home, ".vault-token"))
+	if err != nil {
+		return "", errors.New("no Vault token found; set VAULT_TOKEN or run vault login")
+	}
+	return strings.TrimSpace(string(b)), nil
+}
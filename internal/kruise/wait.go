@@ -0,0 +1,144 @@
+package kruise
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+)
+
+// WaitCondition represents a readiness check of an installer
+type WaitCondition latest.WaitCondition
+
+const (
+	// defaultWaitTimeout is how long a readiness check is retried for if it
+	// has no timeout of its own
+	defaultWaitTimeout = 5 * time.Minute
+)
+
+// probeInterval is how long to wait between attempts of an HTTP probe
+var probeInterval = 2 * time.Second
+
+// wait is used to wait for the readiness checks of a Helm chart
+func (c HelmChart) wait(fs *pflag.FlagSet, out io.Writer) error {
+	return waitFor(fs, out, c.ReleaseName, c.Namespace, c.WaitFor)
+}
+
+// wait is used to wait for the readiness checks of a Kubectl manifest
+func (m KubectlManifest) wait(fs *pflag.FlagSet, out io.Writer) error {
+	return waitFor(fs, out, strings.Join(m.Paths, ", "), m.Namespace, m.WaitFor)
+}
+
+// wait is used to wait for the readiness checks of a kustomization
+func (k KubectlKustomization) wait(fs *pflag.FlagSet, out io.Writer) error {
+	return waitFor(fs, out, k.Path, k.Namespace, k.WaitFor)
+}
+
+// waitFor is used to run the given readiness checks in order, returning an
+// error as soon as one of them doesn't pass within its timeout
+//
+// Checks that don't set a namespace inherit the namespace of their installer.
+func waitFor(fs *pflag.FlagSet, out io.Writer, name string, namespace string, conds []latest.WaitCondition) error {
+	if len(conds) == 0 {
+		return nil
+	}
+	d, err := fs.GetBool("dry-run")
+	if err != nil {
+		Logger.Fatal(err)
+	}
+	if !d {
+		checkKubectl()
+	}
+	for _, c := range conds {
+		w := WaitCondition(c)
+		if w.Namespace == "" {
+			w.Namespace = namespace
+		}
+		if err := w.wait(out, d); err != nil {
+			return fmt.Errorf("%s is not ready: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// wait is used to run the readiness check
+func (w WaitCondition) wait(out io.Writer, dry bool) error {
+	timeout, err := w.timeout()
+	if err != nil {
+		return err
+	}
+	if w.HTTP != "" {
+		if dry {
+			Logger.Infof("Would wait for %s to respond", w.HTTP)
+			return nil
+		}
+		Logger.Infof("Waiting for %s to respond", w.HTTP)
+		return httpProbe(w.HTTP, timeout)
+	}
+	args, err := w.args(timeout)
+	if err != nil {
+		return err
+	}
+	return kubectlExecute(out, dry, args)
+}
+
+// args is used to build the Kubectl CLI args of a rollout, condition or CRD
+// readiness check
+func (w WaitCondition) args(timeout time.Duration) ([]string, error) {
+	var args []string
+	switch {
+	case w.Rollout != "":
+		args = []string{"rollout", "status", w.Rollout, "--namespace", w.Namespace}
+	case w.Condition != "":
+		if w.Resource == "" {
+			return nil, fmt.Errorf("a resource is required to wait for condition %s", w.Condition)
+		}
+		args = []string{"wait", w.Resource, "--for", "condition=" + strings.TrimPrefix(w.Condition, "condition="), "--namespace", w.Namespace}
+		if w.Selector != "" {
+			args = append(args, "--selector", w.Selector)
+		}
+	case w.CRD != "":
+		args = []string{"wait", "crd/" + strings.TrimPrefix(w.CRD, "crd/"), "--for", "condition=Established"}
+	default:
+		return nil, fmt.Errorf("one of rollout, condition, crd or http is required to wait")
+	}
+	return append(args, "--timeout", timeout.String()), nil
+}
+
+// timeout is used to parse the timeout of the readiness check, defaulting to
+// defaultWaitTimeout
+func (w WaitCondition) timeout() (time.Duration, error) {
+	if w.Timeout == "" {
+		return defaultWaitTimeout, nil
+	}
+	t, err := time.ParseDuration(w.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", w.Timeout, err)
+	}
+	return t, nil
+}
+
+// httpProbe is used to poll a URL until it responds with a 2xx status or the
+// timeout elapses
+func httpProbe(url string, timeout time.Duration) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	deadline := time.Now().Add(timeout)
+	for {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+			err = fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		if time.Now().Add(probeInterval).After(deadline) {
+			return fmt.Errorf("timed out after %s: %w", timeout, err)
+		}
+		time.Sleep(probeInterval)
+	}
+}
@@ -0,0 +1,66 @@
+package kruise
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/j2udev/kruise/internal/schema/latest"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitConditionArgs(t *testing.T) {
+	w := WaitCondition{Condition: "Ready", Resource: "pod", Selector: "app=istiod", Namespace: "istio-system"}
+	args, err := w.args(time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wait", "pod", "--for", "condition=Ready", "--namespace", "istio-system", "--selector", "app=istiod", "--timeout", "1m0s"}, args)
+	_, err = WaitCondition{Condition: "Ready"}.args(time.Minute)
+	assert.Error(t, err)
+	_, err = WaitCondition{}.args(time.Minute)
+	assert.Error(t, err)
+	_, err = WaitCondition{Timeout: "soon"}.timeout()
+	assert.Error(t, err)
+}
+
+func TestHTTPProbe(t *testing.T) {
+	interval := probeInterval
+	probeInterval = 10 * time.Millisecond
+	defer func() { probeInterval = interval }()
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	require.NoError(t, httpProbe(srv.URL, time.Second))
+	assert.Equal(t, 3, attempts)
+	attempts = -1000
+	assert.ErrorContains(t, httpProbe(srv.URL, 50*time.Millisecond), "503")
+}
+
+func TestInstallNotReady(t *testing.T) {
+	InitializeLogger()
+	// a stand-in kubectl whose readiness checks time out
+	bin := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(bin, "kubectl"), []byte("#!/bin/sh\n[ \"$1\" = wait ] || exit 0\necho 'timed out waiting for the condition' >&2\nexit 1\n"), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.Bool("dry-run", false, "")
+	m := newKubectlManifest(latest.KubectlManifest{
+		Namespace: "istio-system",
+		Paths:     []string{"gateway.yaml"},
+		WaitFor:   []latest.WaitCondition{{Condition: "Ready", Resource: "pod"}},
+	})
+	var buf bytes.Buffer
+	err := install(m, fs, &buf)
+	assert.EqualError(t, err, "gateway.yaml is not ready: timed out waiting for the condition")
+	assert.Equal(t, 1, exitCode(err))
+}
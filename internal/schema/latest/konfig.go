@@ -12,24 +12,25 @@ func NewKruiseConfig() version.IVersionedConfig {
 type (
 	// KruiseConfig represents the top level keys of the Kruise manifest file
 	KruiseConfig struct {
-		APIVersion string       `mapstructure:"apiVersion"`
-		Kind       string       `mapstructure:"kind"`
-		Logger     LoggerConfig `mapstructure:"logger"`
-		Deploy     DeployConfig `mapstructure:"deploy"`
+		APIVersion string       `mapstructure:"apiVersion" yaml:"apiVersion,omitempty"`
+		Kind       string       `mapstructure:"kind" yaml:"kind,omitempty"`
+		Logger     LoggerConfig `mapstructure:"logger" yaml:"logger,omitempty"`
+		Deploy     DeployConfig `mapstructure:"deploy" yaml:"deploy,omitempty"`
 	}
 
 	// LoggerConfig is used to define charm log configuration
 	LoggerConfig struct {
-		Level      string `mapstructure:"level"`
-		Caller     bool   `mapstructure:"enableCaller"`
-		TimeStamp  bool   `mapstructure:"enableTimestamp"`
-		TimeFormat string `mapstructure:"timeFormat"`
+		Level      string `mapstructure:"level" yaml:"level,omitempty"`
+		Caller     bool   `mapstructure:"enableCaller" yaml:"enableCaller,omitempty"`
+		TimeStamp  bool   `mapstructure:"enableTimestamp" yaml:"enableTimestamp,omitempty"`
+		TimeFormat string `mapstructure:"timeFormat" yaml:"timeFormat,omitempty"`
 	}
 
 	// DeployConfig represents a map of dynamic Deployments
 	DeployConfig struct {
-		Deployments []Deployment `mapstructure:"deployments"`
-		Profiles    []Profile    `mapstructure:"profiles"`
+		Deployments []Deployment `mapstructure:"deployments" yaml:"deployments,omitempty"`
+		Profiles    []Profile    `mapstructure:"profiles" yaml:"profiles,omitempty"`
+		MaxParallel int          `mapstructure:"maxParallel" yaml:"maxParallel,omitempty"`
 	}
 
 	// Deployment represents a flexible means of mapping multiple Helm and
@@ -38,97 +39,290 @@ type (
 	// Aliases and Description are used to determine how the Deployment appears
 	// in the Kruise CLI
 	Deployment struct {
-		Aliases     []string          `mapstructure:"aliases"`
-		Description DeploymentDesc    `mapstructure:"description"`
-		Helm        HelmDeployment    `mapstructure:"helm"`
-		Kubectl     KubectlDeployment `mapstructure:"kubectl"`
-		Name        string            `mapstructure:"name"`
+		Aliases     []string          `mapstructure:"aliases" yaml:"aliases,omitempty"`
+		Description DeploymentDesc    `mapstructure:"description" yaml:"description,omitempty"`
+		Helm        HelmDeployment    `mapstructure:"helm" yaml:"helm,omitempty"`
+		Kubectl     KubectlDeployment `mapstructure:"kubectl" yaml:"kubectl,omitempty"`
+		Exec        []Exec            `mapstructure:"exec" yaml:"exec,omitempty"`
+		Hooks       DeploymentHooks   `mapstructure:"hooks" yaml:"hooks,omitempty"`
+		Name        string            `mapstructure:"name" yaml:"name,omitempty"`
+	}
+
+	// Exec represents an arbitrary tool that is installed and uninstalled with
+	// shell commands
+	Exec struct {
+		Name             string   `mapstructure:"name" yaml:"name,omitempty"`
+		InstallCommand   string   `mapstructure:"install" yaml:"install,omitempty"`
+		UninstallCommand string   `mapstructure:"uninstall" yaml:"uninstall,omitempty"`
+		Env              []KeyVal `mapstructure:"env" yaml:"env,omitempty"`
+		Dir              string   `mapstructure:"dir" yaml:"dir,omitempty"`
+		Priority         int      `mapstructure:"priority" yaml:"priority,omitempty"`
+		Init             bool     `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// DeploymentHooks represents the hooks that run before and after a
+	// Deployment is deployed or deleted
+	DeploymentHooks struct {
+		PreDeploy  []Hook `mapstructure:"preDeploy" yaml:"preDeploy,omitempty"`
+		PostDeploy []Hook `mapstructure:"postDeploy" yaml:"postDeploy,omitempty"`
+		PreDelete  []Hook `mapstructure:"preDelete" yaml:"preDelete,omitempty"`
+		PostDelete []Hook `mapstructure:"postDelete" yaml:"postDelete,omitempty"`
+	}
+
+	// Hook represents a shell command, a Kubectl manifest to apply and/or a Job
+	// to wait for, which run in that order
+	Hook struct {
+		Command   string          `mapstructure:"command" yaml:"command,omitempty"`
+		Manifest  KubectlManifest `mapstructure:"manifest" yaml:"manifest,omitempty"`
+		Job       string          `mapstructure:"job" yaml:"job,omitempty"`
+		Namespace string          `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Timeout   string          `mapstructure:"timeout" yaml:"timeout,omitempty"`
 	}
 
 	// Profile represents a flexible means of bundling together other deployments
 	Profile struct {
-		Aliases     []string       `mapstructure:"aliases"`
-		Items       []string       `mapstructure:"items"`
-		Name        string         `mapstructure:"name"`
-		Description DeploymentDesc `mapstructure:"description"`
+		Aliases     []string       `mapstructure:"aliases" yaml:"aliases,omitempty"`
+		Items       []string       `mapstructure:"items" yaml:"items,omitempty"`
+		Name        string         `mapstructure:"name" yaml:"name,omitempty"`
+		Description DeploymentDesc `mapstructure:"description" yaml:"description,omitempty"`
 	}
 
 	// DeploymentDesc represents the descriptions of the Deployment for the
 	// deploy and delete commands
 	DeploymentDesc struct {
-		Deploy string `mapstructure:"deploy"`
-		Delete string `mapstructure:"delete"`
+		Deploy string `mapstructure:"deploy" yaml:"deploy,omitempty"`
+		Delete string `mapstructure:"delete" yaml:"delete,omitempty"`
 	}
 
 	// HelmDeployment represents multiple Helm repositories and Helm charts
 	HelmDeployment struct {
-		Repositories []HelmRepository `mapstructure:"repositories"`
-		Charts       []HelmChart      `mapstructure:"charts"`
+		Repositories []HelmRepository `mapstructure:"repositories" yaml:"repositories,omitempty"`
+		Charts       []HelmChart      `mapstructure:"charts" yaml:"charts,omitempty"`
 	}
 
-	// KubectlDeployment represents multiple Kubectl secrets and Kubectl manifests
+	// KubectlDeployment represents multiple Kubectl secrets, Kubectl manifests
+	// and kustomizations
 	KubectlDeployment struct {
-		Secrets   KubectlSecrets    `mapstructure:"secrets"`
-		Manifests []KubectlManifest `mapstructure:"manifests"`
+		Secrets        KubectlSecrets         `mapstructure:"secrets" yaml:"secrets,omitempty"`
+		Manifests      []KubectlManifest      `mapstructure:"manifests" yaml:"manifests,omitempty"`
+		Kustomizations []KubectlKustomization `mapstructure:"kustomizations" yaml:"kustomizations,omitempty"`
 	}
 
 	// HelmRepository represents Helm repository information
 	HelmRepository struct {
-		Url     string `mapstructure:"url"`
-		Name    string `mapstructure:"name"`
-		Private bool   `mapstructure:"private"`
-		Init    bool   `mapstructure:"init"`
+		Url         string      `mapstructure:"url" yaml:"url,omitempty"`
+		Name        string      `mapstructure:"name" yaml:"name,omitempty"`
+		Private     bool        `mapstructure:"private" yaml:"private,omitempty"`
+		Credentials Credentials `mapstructure:"credentials" yaml:"credentials,omitempty"`
+		ForceUpdate bool        `mapstructure:"forceUpdate" yaml:"forceUpdate,omitempty"`
+		Init        bool        `mapstructure:"init" yaml:"init,omitempty"`
 	}
 
 	// HelmChart represents Helm chart information
 	HelmChart struct {
-		ChartName     string   `mapstructure:"chartName"`
-		ReleaseName   string   `mapstructure:"releaseName"`
-		RepoName      string   `mapstructure:"repoName"`
-		Namespace     string   `mapstructure:"namespace"`
-		Values        []string `mapstructure:"values"`
-		SetValues     []string `mapstructure:"setValues"`
-		InstallArgs   []string `mapstructure:"installArgs"`
-		UninstallArgs []string `mapstructure:"uninstallArgs"`
-		Priority      int      `mapstructure:"priority"`
-		Version       string   `mapstructure:"version"`
-		Init          bool     `mapstructure:"init"`
+		ChartName     string          `mapstructure:"chartName" yaml:"chartName,omitempty"`
+		ChartPath     string          `mapstructure:"chartPath" yaml:"chartPath,omitempty"`
+		ReleaseName   string          `mapstructure:"releaseName" yaml:"releaseName,omitempty"`
+		RepoName      string          `mapstructure:"repoName" yaml:"repoName,omitempty"`
+		Namespace     string          `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Values        []string        `mapstructure:"values" yaml:"values,omitempty"`
+		SetValues     []string        `mapstructure:"setValues" yaml:"setValues,omitempty"`
+		InstallArgs   []string        `mapstructure:"installArgs" yaml:"installArgs,omitempty"`
+		UninstallArgs []string        `mapstructure:"uninstallArgs" yaml:"uninstallArgs,omitempty"`
+		Priority      int             `mapstructure:"priority" yaml:"priority,omitempty"`
+		Version       string          `mapstructure:"version" yaml:"version,omitempty"`
+		WaitFor       []WaitCondition `mapstructure:"waitFor" yaml:"waitFor,omitempty"`
+		Init          bool            `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// WaitCondition represents a readiness check that has to pass before
+	// installers of a later priority are installed
+	//
+	// Exactly one of Rollout, Condition, CRD or HTTP is expected.
+	WaitCondition struct {
+		Rollout   string `mapstructure:"rollout" yaml:"rollout,omitempty"`
+		Condition string `mapstructure:"condition" yaml:"condition,omitempty"`
+		Resource  string `mapstructure:"resource" yaml:"resource,omitempty"`
+		Selector  string `mapstructure:"selector" yaml:"selector,omitempty"`
+		CRD       string `mapstructure:"crd" yaml:"crd,omitempty"`
+		HTTP      string `mapstructure:"http" yaml:"http,omitempty"`
+		Namespace string `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Timeout   string `mapstructure:"timeout" yaml:"timeout,omitempty"`
 	}
 
 	// KubectlSecrets represents different types of Kubernetes secrets
 	KubectlSecrets struct {
-		Generic        []KubectlGenericSecret        `mapstructure:"generic"`
-		DockerRegistry []KubectlDockerRegistrySecret `mapstructure:"dockerRegistry"`
+		Generic             []KubectlGenericSecret             `mapstructure:"generic" yaml:"generic,omitempty"`
+		DockerRegistry      []KubectlDockerRegistrySecret      `mapstructure:"dockerRegistry" yaml:"dockerRegistry,omitempty"`
+		TLS                 []KubectlTLSSecret                 `mapstructure:"tls" yaml:"tls,omitempty"`
+		BasicAuth           []KubectlBasicAuthSecret           `mapstructure:"basicAuth" yaml:"basicAuth,omitempty"`
+		SSHAuth             []KubectlSSHAuthSecret             `mapstructure:"sshAuth" yaml:"sshAuth,omitempty"`
+		ServiceAccountToken []KubectlServiceAccountTokenSecret `mapstructure:"serviceAccountToken" yaml:"serviceAccountToken,omitempty"`
 	}
 
 	// KubectlGenericSecret represents a generic Kubernetes secret
+	//
+	// Labels and annotations are lists rather than maps because config keys
+	// are case insensitive and split on dots.
 	KubectlGenericSecret struct {
-		Name      string   `mapstructure:"name"`
-		Namespace string   `mapstructure:"namespace"`
-		Literal   []KeyVal `mapstructure:"literal"`
-		Init      bool     `mapstructure:"init"`
+		Name        string       `mapstructure:"name" yaml:"name,omitempty"`
+		Namespace   string       `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Type        string       `mapstructure:"type" yaml:"type,omitempty"`
+		Labels      []KeyVal     `mapstructure:"labels" yaml:"labels,omitempty"`
+		Annotations []KeyVal     `mapstructure:"annotations" yaml:"annotations,omitempty"`
+		Literal     []KeyVal     `mapstructure:"literal" yaml:"literal,omitempty"`
+		FromFile    []KeyFile    `mapstructure:"fromFile" yaml:"fromFile,omitempty"`
+		FromEnvFile []string     `mapstructure:"fromEnvFile" yaml:"fromEnvFile,omitempty"`
+		FromCommand []KeyCommand `mapstructure:"fromCommand" yaml:"fromCommand,omitempty"`
+		OnExists    string       `mapstructure:"onExists" yaml:"onExists,omitempty"`
+		Init        bool         `mapstructure:"init" yaml:"init,omitempty"`
 	}
 
 	// KubectlDockerRegistrySecret represents a docker-registry Kubernetes secret
 	KubectlDockerRegistrySecret struct {
-		Name      string `mapstructure:"name"`
-		Namespace string `mapstructure:"namespace"`
-		Registry  string `mapstructure:"registry"`
-		Init      bool   `mapstructure:"init"`
+		Name        string      `mapstructure:"name" yaml:"name,omitempty"`
+		Namespace   string      `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Registry    string      `mapstructure:"registry" yaml:"registry,omitempty"`
+		Credentials Credentials `mapstructure:"credentials" yaml:"credentials,omitempty"`
+		OnExists    string      `mapstructure:"onExists" yaml:"onExists,omitempty"`
+		Init        bool        `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// KubectlTLSSecret represents a kubernetes.io/tls Kubernetes secret
+	//
+	// The certificate and key are read from files; if neither is set a
+	// self-signed certificate is generated for the SelfSigned hosts instead.
+	KubectlTLSSecret struct {
+		Name       string         `mapstructure:"name" yaml:"name,omitempty"`
+		Namespace  string         `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Cert       string         `mapstructure:"cert" yaml:"cert,omitempty"`
+		Key        string         `mapstructure:"key" yaml:"key,omitempty"`
+		SelfSigned SelfSignedCert `mapstructure:"selfSigned" yaml:"selfSigned,omitempty"`
+		OnExists   string         `mapstructure:"onExists" yaml:"onExists,omitempty"`
+		Init       bool           `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// SelfSignedCert represents a self-signed certificate for development
+	//
+	// The first host is used as the common name and ValidFor is a duration
+	// such as 8760h.
+	SelfSignedCert struct {
+		Hosts    []string `mapstructure:"hosts" yaml:"hosts,omitempty"`
+		ValidFor string   `mapstructure:"validFor" yaml:"validFor,omitempty"`
+	}
+
+	// KubectlBasicAuthSecret represents a kubernetes.io/basic-auth Kubernetes
+	// secret
+	//
+	// Anything that the username and password sources don't resolve is
+	// prompted for.
+	KubectlBasicAuthSecret struct {
+		Name      string       `mapstructure:"name" yaml:"name,omitempty"`
+		Namespace string       `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Username  SecretSource `mapstructure:"username" yaml:"username,omitempty"`
+		Password  SecretSource `mapstructure:"password" yaml:"password,omitempty"`
+		OnExists  string       `mapstructure:"onExists" yaml:"onExists,omitempty"`
+		Init      bool         `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// KubectlSSHAuthSecret represents a kubernetes.io/ssh-auth Kubernetes
+	// secret
+	//
+	// KnownHosts is optional and stored under the known_hosts key.
+	KubectlSSHAuthSecret struct {
+		Name       string       `mapstructure:"name" yaml:"name,omitempty"`
+		Namespace  string       `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		PrivateKey SecretSource `mapstructure:"privateKey" yaml:"privateKey,omitempty"`
+		KnownHosts SecretSource `mapstructure:"knownHosts" yaml:"knownHosts,omitempty"`
+		OnExists   string       `mapstructure:"onExists" yaml:"onExists,omitempty"`
+		Init       bool         `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// KubectlServiceAccountTokenSecret represents a
+	// kubernetes.io/service-account-token Kubernetes secret whose token is
+	// populated by Kubernetes for the given service account
+	KubectlServiceAccountTokenSecret struct {
+		Name           string `mapstructure:"name" yaml:"name,omitempty"`
+		Namespace      string `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		ServiceAccount string `mapstructure:"serviceAccount" yaml:"serviceAccount,omitempty"`
+		OnExists       string `mapstructure:"onExists" yaml:"onExists,omitempty"`
+		Init           bool   `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// Credentials represents the non-interactive sources of a username and
+	// password
+	//
+	// The username and password sources are tried first, followed by the
+	// entry for the registry in a docker config.json or Helm registry config.
+	// Anything that doesn't resolve is prompted for.
+	Credentials struct {
+		Username           SecretSource `mapstructure:"username" yaml:"username,omitempty"`
+		Password           SecretSource `mapstructure:"password" yaml:"password,omitempty"`
+		DockerConfig       string       `mapstructure:"dockerConfig" yaml:"dockerConfig,omitempty"`
+		HelmRegistryConfig string       `mapstructure:"helmRegistryConfig" yaml:"helmRegistryConfig,omitempty"`
+	}
+
+	// SecretSource represents a non-interactive source of a sensitive value
+	//
+	// Only one of the fields is expected to be set; Command is run with sh -c
+	// and its stdout is used as the value. Ref is a provider://path#key
+	// reference to a value held by a secret provider.
+	SecretSource struct {
+		Value   string `mapstructure:"value" yaml:"value,omitempty"`
+		Env     string `mapstructure:"env" yaml:"env,omitempty"`
+		File    string `mapstructure:"file" yaml:"file,omitempty"`
+		Command string `mapstructure:"command" yaml:"command,omitempty"`
+		Ref     string `mapstructure:"ref" yaml:"ref,omitempty"`
 	}
 
 	// KeyVal is used to defined key values pairs as separate parameters
+	//
+	// Ref is a provider://path#key reference to a value held by a secret
+	// provider and is only used for secret literals.
 	KeyVal struct {
-		Key string `mapstructure:"key"`
-		Val string `mapstructure:"value"`
+		Key string `mapstructure:"key" yaml:"key,omitempty"`
+		Val string `mapstructure:"value" yaml:"value,omitempty"`
+		Ref string `mapstructure:"ref" yaml:"ref,omitempty"`
+	}
+
+	// KeyFile is used to define a key whose value is read from a file
+	//
+	// The key defaults to the base name of the file.
+	KeyFile struct {
+		Key  string `mapstructure:"key" yaml:"key,omitempty"`
+		Path string `mapstructure:"path" yaml:"path,omitempty"`
+	}
+
+	// KeyCommand is used to define a key whose value is the stdout of a
+	// command run with sh -c
+	KeyCommand struct {
+		Key     string `mapstructure:"key" yaml:"key,omitempty"`
+		Command string `mapstructure:"command" yaml:"command,omitempty"`
 	}
 
 	// KubectlManifest represents Kubectl manifest information
 	KubectlManifest struct {
-		Namespace string   `mapstructure:"namespace"`
-		Priority  int      `mapstructure:"priority"`
-		Paths     []string `mapstructure:"paths"`
-		Init      bool     `mapstructure:"init"`
+		Namespace      string          `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Priority       int             `mapstructure:"priority" yaml:"priority,omitempty"`
+		Paths          []string        `mapstructure:"paths" yaml:"paths,omitempty"`
+		Template       bool            `mapstructure:"template" yaml:"template,omitempty"`
+		Env            []string        `mapstructure:"env" yaml:"env,omitempty"`
+		ServerSide     bool            `mapstructure:"serverSide" yaml:"serverSide,omitempty"`
+		FieldManager   string          `mapstructure:"fieldManager" yaml:"fieldManager,omitempty"`
+		ForceConflicts bool            `mapstructure:"forceConflicts" yaml:"forceConflicts,omitempty"`
+		Prune          bool            `mapstructure:"prune" yaml:"prune,omitempty"`
+		WaitFor        []WaitCondition `mapstructure:"waitFor" yaml:"waitFor,omitempty"`
+		Init           bool            `mapstructure:"init" yaml:"init,omitempty"`
+	}
+
+	// KubectlKustomization represents a kustomization directory or remote URL
+	// that is applied with kubectl apply -k
+	KubectlKustomization struct {
+		Path      string          `mapstructure:"path" yaml:"path,omitempty"`
+		Namespace string          `mapstructure:"namespace" yaml:"namespace,omitempty"`
+		Priority  int             `mapstructure:"priority" yaml:"priority,omitempty"`
+		WaitFor   []WaitCondition `mapstructure:"waitFor" yaml:"waitFor,omitempty"`
+		Init      bool            `mapstructure:"init" yaml:"init,omitempty"`
 	}
 )
 
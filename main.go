@@ -8,5 +8,7 @@ import (
 
 func main() {
 	kruise.Initialize()
-	cobra.CheckErr(cmd.NewKruiseCmd().Execute())
+	err := cmd.NewKruiseCmd().Execute()
+	kruise.Cleanup()
+	cobra.CheckErr(err)
 }